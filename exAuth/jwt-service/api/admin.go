@@ -0,0 +1,195 @@
+package api
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminAuth accepts requests made with a client certificate verified against
+// ADMIN_CLIENT_CA_FILE, or with an X-Admin-API-Key header matching one of the
+// admin API keys. Without either configured the admin API is disabled.
+// It guards the /admin group only; /token and /introspect share the admin
+// listener but check client credentials instead.
+func (s *Server) adminAuth(c *gin.Context) {
+	if tlsState := c.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) > 0 {
+		log.Printf("Admin request from %s authenticated by client certificate %q", c.ClientIP(), tlsState.VerifiedChains[0][0].Subject.CommonName)
+		c.Next()
+		return
+	}
+
+	if len(s.adminAPIKeys) == 0 {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Admin API is disabled, set ADMIN_API_KEYS or ADMIN_CLIENT_CA_FILE to enable it",
+		})
+		return
+	}
+
+	if !s.validAdminAPIKey(c.GetHeader("X-Admin-API-Key")) {
+		log.Printf("Rejected admin request from %s: invalid API key", c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid admin API key",
+		})
+		return
+	}
+
+	c.Next()
+}
+
+// validAdminAPIKey compares the key against every admin API key in constant
+// time, so keys can be rotated by configuring the old and new one together
+func (s *Server) validAdminAPIKey(key string) bool {
+	valid := false
+	for _, adminAPIKey := range s.adminAPIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// adminAPIKeysFromEnv reads the comma separated ADMIN_API_KEYS and the
+// single ADMIN_API_KEY
+func adminAPIKeysFromEnv() []string {
+	var keys []string
+	for _, key := range strings.Split(os.Getenv("ADMIN_API_KEYS")+","+os.Getenv("ADMIN_API_KEY"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// loadAdminTLSConfig serves the admin listener over TLS when
+// ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE are set. ADMIN_CLIENT_CA_FILE
+// additionally requires every client of the listener, including /token,
+// /health and JWKS fetches, to present a certificate signed by that CA.
+func loadAdminTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("ADMIN_TLS_CERT_FILE"), os.Getenv("ADMIN_TLS_KEY_FILE")
+	clientCAFile := os.Getenv("ADMIN_CLIENT_CA_FILE")
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, fmt.Errorf("ADMIN_CLIENT_CA_FILE requires ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// startAdminServer serves the admin listener, over TLS when configured
+func startAdminServer(addr string, handler http.Handler, tlsConfig *tls.Config) {
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	var err error
+	if tlsConfig != nil {
+		log.Printf("Starting admin server with TLS on %s (client certificates required: %t)", addr, tlsConfig.ClientCAs != nil)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Starting admin server on %s", addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		log.Fatalf("Failed to start admin server: %v", err)
+	}
+}
+
+func (s *Server) revokeTokenHandler(c *gin.Context) {
+	var req struct {
+		Token  string `json:"token" binding:"required"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	if err := s.jwtService.RevokeToken(bearerToken(req.Token), req.Reason); err != nil {
+		log.Printf("Token revocation failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Failed to revoke token: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "revoked",
+	})
+}
+
+func (s *Server) revokeAllCustomerTokensHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	validAfter, err := s.jwtService.RevokeAllCustomerTokens(customerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Customer %s not found", customerID),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Revoking all tokens failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to revoke tokens: %v", err),
+		})
+		return
+	}
+
+	log.Printf("Revoked all tokens for customer %s issued before %s", customerID, validAfter.Format(time.RFC3339))
+	c.JSON(http.StatusOK, gin.H{
+		"status":             "revoked",
+		"customer_id":        customerID,
+		"tokens_valid_after": validAfter.Format(time.RFC3339),
+	})
+}
+
+// cacheStatsHandler reports how often token verification was served from
+// the customer and key cache
+func (s *Server) cacheStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.jwtService.CacheStats())
+}
+
+// rateLimitStatsHandler reports how often customer quotas could not be
+// checked
+func (s *Server) rateLimitStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.quotaStats.stats())
+}
@@ -0,0 +1,344 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// Page sizes of the customer list
+const (
+	defaultCustomerPageSize = 50
+	maxCustomerPageSize     = 200
+)
+
+type createCustomerRequest struct {
+	CustomerID             string   `json:"customer_id"`
+	AccountID              string   `json:"account_id"`
+	SigningAlgorithm       string   `json:"signing_algorithm"`
+	ExpirationMinutes      int      `json:"expiration_minutes"`
+	MaxExpirationMinutes   int      `json:"max_expiration_minutes"`
+	Scopes                 []string `json:"scopes"`
+	RateLimitRequests      int      `json:"rate_limit_requests"`
+	RateLimitPeriodSeconds int      `json:"rate_limit_period_seconds"`
+	RateLimitBurst         int      `json:"rate_limit_burst"`
+}
+
+// updateCustomerRequest holds the settings to change; omitted fields are
+// left as they are
+type updateCustomerRequest struct {
+	AccountID              *string   `json:"account_id"`
+	ExpirationMinutes      *int      `json:"expiration_minutes"`
+	MaxExpirationMinutes   *int      `json:"max_expiration_minutes"`
+	Scopes                 *[]string `json:"scopes"`
+	RateLimitRequests      *int      `json:"rate_limit_requests"`
+	RateLimitPeriodSeconds *int      `json:"rate_limit_period_seconds"`
+	RateLimitBurst         *int      `json:"rate_limit_burst"`
+}
+
+func (r *updateCustomerRequest) apply(customer *models.Customer) {
+	if r.AccountID != nil {
+		customer.AccountID = *r.AccountID
+	}
+	if r.ExpirationMinutes != nil {
+		customer.ExpirationMinutes = *r.ExpirationMinutes
+	}
+	if r.MaxExpirationMinutes != nil {
+		customer.MaxExpirationMinutes = *r.MaxExpirationMinutes
+	}
+	if r.Scopes != nil {
+		customer.Scopes = *r.Scopes
+	}
+	if r.RateLimitRequests != nil {
+		customer.RateLimitRequests = *r.RateLimitRequests
+	}
+	if r.RateLimitPeriodSeconds != nil {
+		customer.RateLimitPeriodSeconds = *r.RateLimitPeriodSeconds
+	}
+	if r.RateLimitBurst != nil {
+		customer.RateLimitBurst = *r.RateLimitBurst
+	}
+}
+
+// createCustomerHandler creates a customer with a new signing key and client
+// credentials. The client secret is only ever returned by this call.
+func (s *Server) createCustomerHandler(c *gin.Context) {
+	var req createCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	customer := &models.Customer{
+		CustomerID:             req.CustomerID,
+		AccountID:              req.AccountID,
+		SigningAlgorithm:       req.SigningAlgorithm,
+		ExpirationMinutes:      req.ExpirationMinutes,
+		MaxExpirationMinutes:   req.MaxExpirationMinutes,
+		Scopes:                 req.Scopes,
+		RateLimitRequests:      req.RateLimitRequests,
+		RateLimitPeriodSeconds: req.RateLimitPeriodSeconds,
+		RateLimitBurst:         req.RateLimitBurst,
+	}
+
+	clientSecret, err := s.jwtService.CreateCustomer(customer)
+	if err != nil {
+		customerError(c, req.CustomerID, "create", err)
+		return
+	}
+
+	log.Printf("Created customer %s through the admin API", customer.CustomerID)
+	c.JSON(http.StatusCreated, gin.H{
+		"customer":      customer,
+		"client_secret": clientSecret,
+	})
+}
+
+func (s *Server) getCustomerHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	customer, err := s.jwtService.DB.GetCustomerByID(customerID)
+	if err != nil {
+		customerError(c, customerID, "get", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// listCustomersHandler returns a page of customers, newest first. The
+// next_offset of the response is omitted on the last page.
+func (s *Server) listCustomersHandler(c *gin.Context) {
+	limit, offset, err := pageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// One extra row tells whether there is a next page
+	customers, err := s.jwtService.DB.ListCustomersPage(limit+1, offset)
+	if err != nil {
+		log.Printf("Failed to list customers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to list customers",
+		})
+		return
+	}
+
+	response := gin.H{}
+	if len(customers) > limit {
+		customers = customers[:limit]
+		response["next_offset"] = offset + limit
+	}
+	if customers == nil {
+		customers = []*models.Customer{}
+	}
+	response["customers"] = customers
+
+	c.JSON(http.StatusOK, response)
+}
+
+// pageParams reads the limit and offset query parameters
+func pageParams(c *gin.Context) (limit, offset int, err error) {
+	limit = defaultCustomerPageSize
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxCustomerPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxCustomerPageSize)
+		}
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// updateCustomerHandler changes the settings present in the request body
+func (s *Server) updateCustomerHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	var req updateCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	customer, err := s.jwtService.DB.GetCustomerByID(customerID)
+	if err != nil {
+		customerError(c, customerID, "get", err)
+		return
+	}
+
+	req.apply(customer)
+	if err := s.jwtService.UpdateCustomer(customer); err != nil {
+		customerError(c, customerID, "update", err)
+		return
+	}
+
+	log.Printf("Updated customer %s through the admin API", customerID)
+	c.JSON(http.StatusOK, customer)
+}
+
+// deleteCustomerHandler removes the customer and everything belonging to it.
+// Suspending keeps the record and can be undone.
+func (s *Server) deleteCustomerHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	if err := s.jwtService.DeleteCustomer(customerID); err != nil {
+		customerError(c, customerID, "delete", err)
+		return
+	}
+
+	log.Printf("Deleted customer %s through the admin API", customerID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "deleted",
+		"customer_id": customerID,
+	})
+}
+
+// suspendCustomerHandler suspends the customer, or disables it and revokes
+// its tokens when the body sets "disable". The body is optional.
+func (s *Server) suspendCustomerHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	var req struct {
+		Reason  string `json:"reason"`
+		Disable bool   `json:"disable"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	status := models.CustomerStatusSuspended
+	var err error
+	if req.Disable {
+		status = models.CustomerStatusDisabled
+		err = s.jwtService.DisableCustomer(customerID, req.Reason)
+	} else {
+		err = s.jwtService.SuspendCustomer(customerID, req.Reason)
+	}
+	if err != nil {
+		customerError(c, customerID, "suspend", err)
+		return
+	}
+
+	log.Printf("Customer %s is now %s through the admin API", customerID, status)
+	c.JSON(http.StatusOK, gin.H{
+		"status":      status,
+		"customer_id": customerID,
+	})
+}
+
+func (s *Server) resumeCustomerHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	if err := s.jwtService.ResumeCustomer(customerID); err != nil {
+		customerError(c, customerID, "resume", err)
+		return
+	}
+
+	log.Printf("Resumed customer %s through the admin API", customerID)
+	c.JSON(http.StatusOK, gin.H{
+		"status":      models.CustomerStatusActive,
+		"customer_id": customerID,
+	})
+}
+
+// rotateCustomerKeyHandler generates a new active signing key. The body is
+// optional: an empty algorithm keeps the current one and the overlap
+// defaults to 24h.
+func (s *Server) rotateCustomerKeyHandler(c *gin.Context) {
+	customerID := c.Param("id")
+
+	var req struct {
+		Algorithm string `json:"algorithm"`
+		Overlap   string `json:"overlap"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	if req.Algorithm != "" && !slices.Contains(auth.SupportedAlgorithms, req.Algorithm) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Unsupported signing algorithm %q", req.Algorithm),
+		})
+		return
+	}
+
+	overlap := 24 * time.Hour
+	if req.Overlap != "" {
+		parsed, err := time.ParseDuration(req.Overlap)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid overlap %q", req.Overlap),
+			})
+			return
+		}
+		overlap = parsed
+	}
+
+	key, err := s.jwtService.RotateCustomerKey(customerID, req.Algorithm, overlap)
+	if err != nil {
+		customerError(c, customerID, "rotate the key of", err)
+		return
+	}
+
+	log.Printf("Rotated signing key of customer %s through the admin API, new kid %s", customerID, key.KID)
+	response := gin.H{"key": key}
+	if overlap > 0 {
+		response["previous_key_verifies_until"] = time.Now().Add(overlap).Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// customerError maps an error from a customer operation to a response
+func customerError(c *gin.Context, customerID, action string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Customer %s not found", customerID),
+		})
+	case errors.Is(err, db.ErrCustomerExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A customer with this customer_id or account_id already exists",
+		})
+	case errors.Is(err, auth.ErrInvalidCustomer):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		log.Printf("Failed to %s customer %s: %v", action, customerID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to %s customer", action),
+		})
+	}
+}
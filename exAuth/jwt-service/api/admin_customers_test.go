@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+)
+
+func TestAdminCustomerValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Every case is rejected before the database is used
+	server := &Server{
+		engine:       gin.New(),
+		adminEngine:  gin.New(),
+		jwtService:   auth.NewJWTService(&db.Database{DB: nil}),
+		adminAPIKeys: []string{"test-admin-key"},
+	}
+	server.setupRoutes()
+
+	tests := map[string]struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		"invalid JSON":          {http.MethodPost, "/admin/v1/customers", "{", http.StatusBadRequest},
+		"missing account":       {http.MethodPost, "/admin/v1/customers", `{"customer_id": "acme"}`, http.StatusBadRequest},
+		"unsupported algorithm": {http.MethodPost, "/admin/v1/customers", `{"customer_id": "acme", "account_id": "a", "signing_algorithm": "none"}`, http.StatusBadRequest},
+		"invalid limit":         {http.MethodGet, "/admin/v1/customers?limit=1000", "", http.StatusBadRequest},
+		"negative offset":       {http.MethodGet, "/admin/v1/customers?offset=-1", "", http.StatusBadRequest},
+		"invalid update":        {http.MethodPatch, "/admin/v1/customers/acme", `{"expiration_minutes": "soon"}`, http.StatusBadRequest},
+		"rotate algorithm":      {http.MethodPost, "/admin/v1/customers/acme/rotate-key", `{"algorithm": "none"}`, http.StatusBadRequest},
+		"rotate overlap":        {http.MethodPost, "/admin/v1/customers/acme/rotate-key", `{"overlap": "-1h"}`, http.StatusBadRequest},
+		"invalid suspend":       {http.MethodPost, "/admin/v1/customers/acme/suspend", `{"disable": "yes"}`, http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Admin-API-Key", "test-admin-key")
+			rec := httptest.NewRecorder()
+
+			server.adminEngine.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			var response map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.NotEmpty(t, response["error"])
+		})
+	}
+
+	// The customer API requires the admin key like the rest of /admin
+	req, _ := http.NewRequest(http.MethodGet, "/admin/v1/customers", nil)
+	rec := httptest.NewRecorder()
+	server.adminEngine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminRoutesNotOnVerificationListener(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{
+		engine:       gin.New(),
+		adminEngine:  gin.New(),
+		jwtService:   auth.NewJWTService(&db.Database{DB: nil}),
+		adminAPIKeys: []string{"test-admin-key"},
+	}
+	server.setupRoutes()
+
+	// On the data plane listener these paths are requests to verify
+	for _, path := range []string{"/token", "/introspect", "/admin/v1/customers"} {
+		req, _ := http.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("X-Admin-API-Key", "test-admin-key")
+		rec := httptest.NewRecorder()
+		server.engine.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), reasonMissingToken, path)
+	}
+}
+
+func TestHealthAndJWKSNotOnVerificationListener(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{
+		engine:      gin.New(),
+		adminEngine: gin.New(),
+		jwtService:  auth.NewJWTService(db.NewMemoryStore()),
+	}
+	server.setupRoutes()
+
+	// Upstream requests to these paths must not be let through without a
+	// token
+	for _, path := range []string{"/health", "/.well-known/jwks.json", "/customers/acme/jwks.json", "/"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		server.engine.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), reasonMissingToken, path)
+	}
+
+	for _, path := range []string{"/health", "/.well-known/jwks.json"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		server.adminEngine.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAdminTestRouter(adminAPIKeys ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{adminAPIKeys: adminAPIKeys}
+	router := gin.New()
+	router.GET("/admin/ping", server.adminAuth, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	return router
+}
+
+func TestAdminAuth(t *testing.T) {
+	router := newAdminTestRouter("test-admin-key")
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ping", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/ping", nil)
+	req.Header.Set("X-Admin-API-Key", "wrong-key")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/admin/ping", nil)
+	req.Header.Set("X-Admin-API-Key", "test-admin-key")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAdminAuthDisabled(t *testing.T) {
+	router := newAdminTestRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ping", nil)
+	req.Header.Set("X-Admin-API-Key", "")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestAdminAuthMultipleKeys(t *testing.T) {
+	router := newAdminTestRouter("old-key", "new-key")
+
+	for _, key := range []string{"old-key", "new-key"} {
+		req, _ := http.NewRequest(http.MethodGet, "/admin/ping", nil)
+		req.Header.Set("X-Admin-API-Key", key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+}
+
+func TestAdminAuthClientCertificate(t *testing.T) {
+	// Without API keys, a verified client certificate is still accepted
+	router := newAdminTestRouter()
+
+	req, _ := http.NewRequest(http.MethodGet, "/admin/ping", nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "provisioner"}}}},
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// An unverified TLS connection is not enough
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestAdminAPIKeysFromEnv(t *testing.T) {
+	t.Setenv("ADMIN_API_KEYS", "key-a, key-b,")
+	t.Setenv("ADMIN_API_KEY", "key-c")
+	assert.Equal(t, []string{"key-a", "key-b", "key-c"}, adminAPIKeysFromEnv())
+}
+
+func TestLoadAdminTLSConfig(t *testing.T) {
+	config, err := loadAdminTLSConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+
+	// mTLS needs the listener to serve TLS
+	t.Setenv("ADMIN_CLIENT_CA_FILE", "/etc/jwt-service/ca.pem")
+	_, err = loadAdminTLSConfig()
+	assert.Error(t, err)
+}
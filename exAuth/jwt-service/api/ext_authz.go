@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/policy"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// requestAttributes describes the original client request that Envoy is
+// asking us to authorize.
+type requestAttributes struct {
+	Host     string
+	Path     string
+	Method   string
+	SourceIP string
+	Audience string // required token audience of the route, if any
+}
+
+// audienceContextExtension is the ext_authz context extension that sets the
+// audience a route requires, e.g. in the route's per_filter_config:
+//
+//	envoy.filters.http.ext_authz:
+//	  check_settings:
+//	    context_extensions:
+//	      audience: payments-api
+//
+// HTTP ext_authz has no context extensions; there, and for gRPC as well,
+// route audiences are set with the audiences of policy rules.
+const audienceContextExtension = "audience"
+
+// authorizationServer implements the Envoy ext_authz gRPC API
+// (envoy.service.auth.v3.Authorization) on top of JWTService.
+type authorizationServer struct {
+	authv3.UnimplementedAuthorizationServer
+	jwtService *auth.JWTService
+	authorizer policy.Authorizer // nil when no policy is configured
+	quotas     *customerQuotas   // nil when rate limiting is off
+}
+
+func newAuthorizationServer(jwtService *auth.JWTService, authorizer policy.Authorizer, quotas *customerQuotas) *authorizationServer {
+	return &authorizationServer{jwtService: jwtService, authorizer: authorizer, quotas: quotas}
+}
+
+// Check verifies the bearer token of the original request and returns the
+// same identity headers as the HTTP verifier as header mutations.
+func (a *authorizationServer) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attrs := checkRequestAttributes(req)
+	log.Printf("Incoming gRPC Check request - Method: %s, Host: %s, Path: %s, IP: %s",
+		attrs.Method, attrs.Host, attrs.Path, attrs.SourceIP)
+
+	// Requests to public routes do not need a token
+	policyRequest := policy.Request{Host: attrs.Host, Path: attrs.Path, Method: attrs.Method}
+	if publicRequest(a.authorizer, policyRequest) {
+		log.Printf("Allowing public request - Method: %s, Host: %s, Path: %s", attrs.Method, attrs.Host, attrs.Path)
+		return &authv3.CheckResponse{
+			Status:       &rpcstatus.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: &authv3.OkHttpResponse{}},
+		}, nil
+	}
+
+	// Envoy lower-cases HTTP/1 header names in the attribute context
+	authHeader := req.GetAttributes().GetRequest().GetHttp().GetHeaders()["authorization"]
+	if authHeader == "" {
+		log.Printf("No Authorization header found in request")
+		return deniedResponse(codes.Unauthenticated, typev3.StatusCode_Unauthorized, "Authorization header required", reasonMissingToken), nil
+	}
+
+	payload, err := a.jwtService.VerifyTokenForAudience(bearerToken(authHeader), attrs.Audience)
+	if err != nil {
+		log.Printf("Token verification failed: %v", err)
+		return deniedResponse(codes.Unauthenticated, typev3.StatusCode_Unauthorized, err.Error(), rejectionReason(err)), nil
+	}
+
+	log.Printf("Token verification successful - Customer ID: %s, Account ID: %s, User ID: %s",
+		payload.CustomerID, payload.AccountID, payload.UserID)
+
+	// Route-level authorization: the token must carry the route's scope
+	requiredScope, err := a.jwtService.RequiredScope(attrs.Host, attrs.Path, attrs.Method)
+	if err != nil {
+		log.Printf("Failed to load route scopes: %v", err)
+		return deniedResponse(codes.Unavailable, typev3.StatusCode_ServiceUnavailable, "Authorization policy unavailable", reasonPolicyUnavailable), nil
+	}
+	if requiredScope != "" && !payload.HasScope(requiredScope) {
+		log.Printf("Customer %s lacks scope %s for %s %s%s", payload.CustomerID, requiredScope, attrs.Method, attrs.Host, attrs.Path)
+		return deniedResponse(codes.PermissionDenied, typev3.StatusCode_Forbidden, fmt.Sprintf("Token is missing required scope %s", requiredScope), reasonInsufficientScope), nil
+	}
+
+	// Apply the authorization policy to the verified token
+	if decision := authorizeRequest(a.authorizer, a.jwtService, policyRequest, payload); !decision.Allowed {
+		log.Printf("Policy denied request - Method: %s, Host: %s, Path: %s: %s", attrs.Method, attrs.Host, attrs.Path, decision.Reason)
+		return deniedResponse(codes.PermissionDenied, typev3.StatusCode_Forbidden, decision.Reason, reasonPolicyDenied), nil
+	}
+
+	// Enforce the customer's request quota
+	var responseHeaders []*corev3.HeaderValueOption
+	result, limited, err := a.quotas.checkRateLimit(a.jwtService, payload.CustomerID)
+	if err != nil {
+		return deniedResponse(codes.Unavailable, typev3.StatusCode_ServiceUnavailable, "Rate limits unavailable", reasonRateLimitUnavailable), nil
+	}
+	if limited {
+		for _, header := range rateLimitHeaders(result) {
+			responseHeaders = append(responseHeaders, headerValue(header[0], header[1]))
+		}
+		if !result.Allowed {
+			log.Printf("Rate limit exceeded for customer %s", payload.CustomerID)
+			return deniedResponse(codes.ResourceExhausted, typev3.StatusCode_TooManyRequests, "Rate limit exceeded", reasonRateLimited, responseHeaders...), nil
+		}
+	}
+
+	headers := []*corev3.HeaderValueOption{
+		headerValue("X-Customer-ID", payload.CustomerID),
+	}
+	if payload.AccountID != "" {
+		headers = append(headers, headerValue("X-Account-ID", payload.AccountID))
+	}
+	if payload.UserID != "" {
+		headers = append(headers, headerValue("X-User-ID", payload.UserID))
+	}
+	headers = append(headers,
+		headerValue("X-Token-Verified", "true"),
+		headerValue("X-Token-Expiration", time.Unix(payload.Exp, 0).Format(time.RFC3339)),
+	)
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{Headers: headers, ResponseHeadersToAdd: responseHeaders},
+		},
+	}, nil
+}
+
+// checkRequestAttributes extracts the request details from the ext_authz
+// attribute context.
+func checkRequestAttributes(req *authv3.CheckRequest) requestAttributes {
+	httpReq := req.GetAttributes().GetRequest().GetHttp()
+	// Envoy passes the path with the query string, the HTTP verifier sees
+	// it without; policies match the same path on both
+	path, _, _ := strings.Cut(httpReq.GetPath(), "?")
+	return requestAttributes{
+		Host:     httpReq.GetHost(),
+		Path:     path,
+		Method:   httpReq.GetMethod(),
+		SourceIP: req.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
+		Audience: req.GetAttributes().GetContextExtensions()[audienceContextExtension],
+	}
+}
+
+// Machine readable rejection reasons returned alongside the error message
+const (
+	reasonMissingToken          = "missing_token"
+	reasonInvalidToken          = "invalid_token"
+	reasonTokenRevoked          = "token_revoked"
+	reasonCustomerTokensRevoked = "customer_tokens_revoked"
+	reasonCustomerSuspended     = "customer_suspended"
+	reasonCustomerDisabled      = "customer_disabled"
+	reasonInvalidAudience       = "invalid_audience"
+	reasonInsufficientScope     = "insufficient_scope"
+	reasonPolicyUnavailable     = "policy_unavailable"
+)
+
+// rejectionReason maps a VerifyToken error to a rejection reason
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return reasonTokenRevoked
+	case errors.Is(err, auth.ErrCustomerTokensRevoked):
+		return reasonCustomerTokensRevoked
+	case errors.Is(err, auth.ErrCustomerSuspended):
+		return reasonCustomerSuspended
+	case errors.Is(err, auth.ErrCustomerDisabled):
+		return reasonCustomerDisabled
+	case errors.Is(err, auth.ErrInvalidAudience):
+		return reasonInvalidAudience
+	default:
+		return reasonInvalidToken
+	}
+}
+
+// deniedResponse builds a CheckResponse that makes Envoy reject the request
+// with the given HTTP status, a JSON error body and any extra headers.
+func deniedResponse(code codes.Code, httpStatus typev3.StatusCode, message, reason string, headers ...*corev3.HeaderValueOption) *authv3.CheckResponse {
+	body, _ := json.Marshal(map[string]string{"error": message, "reason": reason})
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status: &typev3.HttpStatus{Code: httpStatus},
+				Headers: append([]*corev3.HeaderValueOption{
+					headerValue("Content-Type", "application/json"),
+				}, headers...),
+				Body: string(body),
+			},
+		},
+	}
+}
+
+func headerValue(key, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: key, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// bearerToken handles both "Bearer <token>" and raw token formats
+func bearerToken(authHeader string) string {
+	return strings.TrimPrefix(authHeader, "Bearer ")
+}
+
+// startGRPCServer serves the ext_authz gRPC API on the given port, together
+// with the rate limit service unless it is nil
+func startGRPCServer(port string, authorizationService *authorizationServer, rateLimitService *rateLimitServer) {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		log.Fatalf("Failed to listen on gRPC port %s: %v", port, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(grpcServer, authorizationService)
+	if rateLimitService != nil {
+		rlsv3.RegisterRateLimitServiceServer(grpcServer, rateLimitService)
+		log.Printf("Serving the rate limit service on gRPC port %s", port)
+	}
+
+	log.Printf("Starting ext_authz gRPC server on port %s", port)
+	if err := grpcServer.Serve(listener); err != nil {
+		log.Fatalf("Failed to start gRPC server: %v", err)
+	}
+}
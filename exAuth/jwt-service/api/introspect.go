@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vishalk17/jwt-service/auth"
+)
+
+// introspectHandler implements RFC 7662 token introspection for services that
+// cannot run behind Envoy. Callers authenticate with introspection client
+// credentials (HTTP Basic or form fields), never customer credentials.
+func (s *Server) introspectHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	clientID, clientSecret, err := clientCredentials(c)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, err := s.jwtService.AuthenticateIntrospectionClient(clientID, clientSecret)
+	if errors.Is(err, auth.ErrInvalidClient) {
+		log.Printf("Introspection client authentication failed for client %q from %s", clientID, c.ClientIP())
+		c.Header("WWW-Authenticate", `Basic realm="jwt-service"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+	if err != nil {
+		log.Printf("Introspection client authentication error: %v", err)
+		oauthError(c, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	response := s.jwtService.Introspect(token)
+	log.Printf("Token introspected by %s (%s) - active: %t", client.Name, client.ClientID, response.Active)
+	c.JSON(http.StatusOK, response)
+}
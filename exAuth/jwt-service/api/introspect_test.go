@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+)
+
+func TestIntrospectHandlerRequiresClientCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{jwtService: auth.NewJWTService(&db.Database{DB: nil})}
+	router := gin.New()
+	router.POST("/introspect", server.introspectHandler)
+
+	form := url.Values{"token": {"some.jwt.token"}}
+	req, _ := http.NewRequest(http.MethodPost, "/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "invalid_client", response["error"])
+	assert.NotContains(t, response, "active")
+}
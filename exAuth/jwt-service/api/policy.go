@@ -0,0 +1,84 @@
+package api
+
+import (
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/models"
+	"github.com/vishalk17/jwt-service/policy"
+)
+
+// reasonPolicyDenied is returned with 403s from the authorization policy
+const reasonPolicyDenied = "policy_denied"
+
+// loadAuthorizer builds the authorizer from the rule policy (POLICY_FILE)
+// and CEL policy (CEL_POLICY_FILE) files. Both are optional, reloaded when
+// they change and, if both are set, must both allow a request, and both make
+// a route public for it to be reachable without a token.
+func loadAuthorizer() (policy.Authorizer, error) {
+	var authorizers policy.Chain
+
+	if policyFile := os.Getenv("POLICY_FILE"); policyFile != "" {
+		store, err := policy.NewFileStore(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded policy file %s", policyFile)
+		authorizers = append(authorizers, store)
+	}
+
+	if celPolicyFile := os.Getenv("CEL_POLICY_FILE"); celPolicyFile != "" {
+		store, err := policy.NewCELFileStore(celPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded CEL policy file %s", celPolicyFile)
+		authorizers = append(authorizers, store)
+	}
+
+	switch len(authorizers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return authorizers[0], nil
+	default:
+		return authorizers, nil
+	}
+}
+
+// httpPolicyRequest describes the original request of an HTTP ext_authz
+// check. Envoy forwards the original method and path; the original host is
+// taken from X-Forwarded-Host when set.
+func httpPolicyRequest(c *gin.Context) policy.Request {
+	host := c.GetHeader("X-Forwarded-Host")
+	if host == "" {
+		host = c.Request.Host
+	}
+	return policy.Request{
+		Host:   host,
+		Path:   c.Request.URL.Path,
+		Method: c.Request.Method,
+	}
+}
+
+// publicRequest reports whether the policy allows the request without a token
+func publicRequest(authorizer policy.Authorizer, req policy.Request) bool {
+	return authorizer != nil && authorizer.Public(req)
+}
+
+// authorizeRequest applies the policy to a request with a verified token.
+// Without a policy every valid token is allowed.
+func authorizeRequest(authorizer policy.Authorizer, jwtService *auth.JWTService, req policy.Request, payload *models.JWTPayload) policy.Decision {
+	if authorizer == nil {
+		return policy.Decision{Allowed: true}
+	}
+	return authorizer.Authorize(policy.Input{
+		Request: req,
+		Token:   payload,
+		Customer: func() (*models.Customer, error) {
+			return jwtService.GetCustomer(payload.CustomerID)
+		},
+	})
+}
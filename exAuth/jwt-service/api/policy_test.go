@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+	"github.com/vishalk17/jwt-service/policy"
+	"google.golang.org/grpc/codes"
+)
+
+func newTestPolicyStore(t *testing.T, data string) *policy.FileStore {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(data), 0o644))
+
+	store, err := policy.NewFileStore(filename)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+const publicRoutePolicy = `
+rules:
+- name: public
+  paths: ["/public/*"]
+  public: true
+`
+
+func TestCheckPublicRoute(t *testing.T) {
+	server := newAuthorizationServer(auth.NewJWTService(&db.Database{DB: nil}), newTestPolicyStore(t, publicRoutePolicy), nil)
+
+	req := newCheckRequest(map[string]string{})
+	req.Attributes.Request.Http.Path = "/public/status"
+
+	resp, err := server.Check(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(codes.OK), resp.GetStatus().GetCode())
+	assert.NotNil(t, resp.GetOkResponse())
+
+	// Other routes still need a token
+	resp, err = server.Check(context.Background(), newCheckRequest(map[string]string{}))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(codes.Unauthenticated), resp.GetStatus().GetCode())
+}
+
+func TestVerifyJWTHandlerPublicRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{
+		engine:      gin.New(),
+		adminEngine: gin.New(),
+		jwtService:  auth.NewJWTService(&db.Database{DB: nil}),
+		authorizer:  newTestPolicyStore(t, publicRoutePolicy),
+	}
+	server.setupRoutes()
+
+	// Original requests forwarded by Envoy reach the verifier on any path
+	req, _ := http.NewRequest(http.MethodGet, "/public/status", nil)
+	req.Header.Set("X-Forwarded-Host", "www.example.com")
+	rec := httptest.NewRecorder()
+	server.engine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, _ = http.NewRequest(http.MethodGet, "/private", nil)
+	rec = httptest.NewRecorder()
+	server.engine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), reasonMissingToken)
+}
+
+func TestVerifyJWTHandlerRouteScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := db.NewMemoryStore()
+	jwtService := auth.NewJWTService(store)
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", Scopes: []string{"orders:read", "orders:write"}})
+	require.NoError(t, err)
+	require.NoError(t, store.CreateRouteScope(&models.RouteScope{PathPrefix: "/orders", Method: "POST", Scope: "orders:write"}))
+
+	server := &Server{engine: gin.New(), adminEngine: gin.New(), jwtService: jwtService}
+	server.setupRoutes()
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/orders/42", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		server.engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	readOnly, _, err := jwtService.CreateCustomerJWT("acme", "", []string{"orders:read"}, 0)
+	require.NoError(t, err)
+	rec := verify(readOnly)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), reasonInsufficientScope)
+
+	readWrite, _, err := jwtService.CreateCustomerJWT("acme", "", []string{"orders:read", "orders:write"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, verify(readWrite).Code)
+}
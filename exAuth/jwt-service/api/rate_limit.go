@@ -0,0 +1,172 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/ratelimit"
+)
+
+const (
+	// reasonRateLimited is returned with 429s when a customer exceeds its quota
+	reasonRateLimited = "rate_limited"
+	// reasonRateLimitUnavailable is returned with 503s when a quota cannot be
+	// checked and rate limiting fails closed
+	reasonRateLimitUnavailable = "rate_limit_unavailable"
+)
+
+// rateLimitBucketIdleTime is how long an unused shared bucket is kept
+const rateLimitBucketIdleTime = 24 * time.Hour
+
+// newRateLimiter creates the limiter selected by RATE_LIMIT_STORE: "memory"
+// (the default, one quota per replica), "postgres" (one quota shared by all
+// replicas) or "off"
+func newRateLimiter(database db.CustomerStore) (ratelimit.Limiter, error) {
+	switch store := os.Getenv("RATE_LIMIT_STORE"); store {
+	case "", "memory":
+		return ratelimit.NewMemoryLimiter(), nil
+	case "postgres":
+		return ratelimit.NewPostgresLimiter(database), nil
+	case "off":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", store)
+	}
+}
+
+// customerQuotas enforces the customers' rate limits with limiter. A quota
+// that cannot be checked, e.g. because the shared bucket store is
+// unreachable, lets the request through unless failClosed is set. Either
+// way the failure is counted.
+type customerQuotas struct {
+	limiter    ratelimit.Limiter // nil when rate limiting is off
+	failClosed bool
+	failures   atomic.Uint64
+}
+
+// RateLimitStats reports how often quotas could not be checked
+type RateLimitStats struct {
+	FailureMode string `json:"failure_mode"`
+	Failures    uint64 `json:"failures"`
+}
+
+// Rate limit failure modes (RATE_LIMIT_FAILURE_MODE)
+const (
+	rateLimitFailOpen   = "open"
+	rateLimitFailClosed = "closed"
+)
+
+// newCustomerQuotas enforces quotas with limiter, failing open or closed as
+// set by RATE_LIMIT_FAILURE_MODE: "open" (the default, an outage of the
+// bucket store does not fail every customer) or "closed"
+func newCustomerQuotas(limiter ratelimit.Limiter) (*customerQuotas, error) {
+	switch mode := os.Getenv("RATE_LIMIT_FAILURE_MODE"); mode {
+	case "", rateLimitFailOpen:
+		return &customerQuotas{limiter: limiter}, nil
+	case rateLimitFailClosed:
+		return &customerQuotas{limiter: limiter, failClosed: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_FAILURE_MODE %q", mode)
+	}
+}
+
+// errRateLimitUnavailable is returned by checkRateLimit when a quota cannot
+// be checked and rate limiting fails closed
+var errRateLimitUnavailable = errors.New("rate limits unavailable")
+
+// checkRateLimit takes a request from the customer's quota. ok is false
+// when the customer is not limited or the limit could not be checked and
+// rate limiting fails open; failing closed returns errRateLimitUnavailable.
+func (q *customerQuotas) checkRateLimit(jwtService *auth.JWTService, customerID string) (result ratelimit.Result, ok bool, err error) {
+	if q == nil {
+		return ratelimit.Result{}, false, nil
+	}
+
+	result, limit, err := customerRateLimit(q.limiter, jwtService, customerID, 1)
+	if err != nil {
+		q.failures.Add(1)
+		log.Printf("Failed to check rate limit of customer %s: %v", customerID, err)
+		if q.failClosed {
+			return ratelimit.Result{}, false, errRateLimitUnavailable
+		}
+		return ratelimit.Result{}, false, nil
+	}
+	return result, !limit.Unlimited(), nil
+}
+
+func (q *customerQuotas) stats() RateLimitStats {
+	if q == nil {
+		return RateLimitStats{FailureMode: rateLimitFailOpen}
+	}
+	mode := rateLimitFailOpen
+	if q.failClosed {
+		mode = rateLimitFailClosed
+	}
+	return RateLimitStats{FailureMode: mode, Failures: q.failures.Load()}
+}
+
+// customerRateLimit takes hits requests from the customer's quota. The
+// result is only meaningful when the returned limit is not unlimited.
+func customerRateLimit(limiter ratelimit.Limiter, jwtService *auth.JWTService, customerID string, hits int) (ratelimit.Result, ratelimit.Limit, error) {
+	if limiter == nil {
+		return ratelimit.Result{}, ratelimit.Limit{}, nil
+	}
+
+	customer, err := jwtService.GetCustomer(customerID)
+	if err != nil {
+		return ratelimit.Result{}, ratelimit.Limit{}, fmt.Errorf("failed to get customer %s: %w", customerID, err)
+	}
+
+	limit := ratelimit.CustomerLimit(customer)
+	if limit.Unlimited() {
+		return ratelimit.Result{}, limit, nil
+	}
+
+	result, err := limiter.AllowN(customerID, limit, hits)
+	if err != nil {
+		return ratelimit.Result{}, limit, err
+	}
+	return result, limit, nil
+}
+
+// rateLimitHeaders returns the X-RateLimit-* headers, plus Retry-After when
+// the request was rejected. Durations are rounded up to whole seconds.
+func rateLimitHeaders(result ratelimit.Result) [][2]string {
+	headers := [][2]string{
+		{"X-RateLimit-Limit", strconv.Itoa(result.Limit)},
+		{"X-RateLimit-Remaining", strconv.Itoa(result.Remaining)},
+		{"X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset))},
+	}
+	if !result.Allowed {
+		headers = append(headers, [2]string{"Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter))})
+	}
+	return headers
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// purgeIdleRateLimitBuckets garbage collects shared buckets of customers
+// that stopped sending requests
+func purgeIdleRateLimitBuckets(database db.CustomerStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := database.PurgeIdleRateLimitBuckets(rateLimitBucketIdleTime)
+		if err != nil {
+			log.Printf("Failed to purge idle rate limit buckets: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d idle rate limit buckets", purged)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// defaultRateLimitDescriptorKey is the descriptor entry holding the customer
+// ID. Envoy builds it from the header ext_authz injects:
+//
+//	rate_limits:
+//	- actions:
+//	  - request_headers:
+//	      header_name: x-customer-id
+//	      descriptor_key: customer_id
+const defaultRateLimitDescriptorKey = "customer_id"
+
+// rateLimitServer implements the Envoy Rate Limit Service gRPC API
+// (envoy.service.ratelimit.v3.RateLimitService) with the customers' quotas.
+type rateLimitServer struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	jwtService    *auth.JWTService
+	quotas        *customerQuotas
+	descriptorKey string
+}
+
+func newRateLimitServer(jwtService *auth.JWTService, quotas *customerQuotas, descriptorKey string) *rateLimitServer {
+	if descriptorKey == "" {
+		descriptorKey = defaultRateLimitDescriptorKey
+	}
+	return &rateLimitServer{jwtService: jwtService, quotas: quotas, descriptorKey: descriptorKey}
+}
+
+// ShouldRateLimit checks each descriptor carrying a customer ID against that
+// customer's quota. Descriptors without one, unknown customers and customers
+// without a limit are not limited. A customer is charged once per request
+// however many descriptors carry its ID, and they all get the same status.
+// Other failures are counted and return an error, so that Envoy's
+// failure_mode_deny rather than RATE_LIMIT_FAILURE_MODE decides what happens
+// to the request.
+func (r *rateLimitServer) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	hits := int(req.GetHitsAddend())
+	if hits == 0 {
+		hits = 1
+	}
+
+	type customerStatus struct {
+		result ratelimit.Result
+		limit  ratelimit.Limit // unlimited for unknown customers
+	}
+	charged := make(map[string]customerStatus)
+
+	response := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+	for _, descriptor := range req.GetDescriptors() {
+		descriptorStatus := &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+		response.Statuses = append(response.Statuses, descriptorStatus)
+
+		customerID := ""
+		for _, entry := range descriptor.GetEntries() {
+			if entry.GetKey() == r.descriptorKey {
+				customerID = entry.GetValue()
+			}
+		}
+		if customerID == "" {
+			continue
+		}
+
+		customer, ok := charged[customerID]
+		if !ok {
+			result, limit, err := customerRateLimit(r.quotas.limiter, r.jwtService, customerID, hits)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				r.quotas.failures.Add(1)
+				log.Printf("Failed to check rate limit of customer %s: %v", customerID, err)
+				return nil, status.Error(codes.Unavailable, "rate limits unavailable")
+			}
+			customer = customerStatus{result: result, limit: limit}
+			charged[customerID] = customer
+			if !limit.Unlimited() && !result.Allowed {
+				log.Printf("Rate limit exceeded for customer %s", customerID)
+			}
+		}
+		if customer.limit.Unlimited() {
+			continue
+		}
+		result, limit := customer.result, customer.limit
+
+		descriptorStatus.CurrentLimit = currentLimit(limit)
+		descriptorStatus.LimitRemaining = uint32(result.Remaining)
+		descriptorStatus.DurationUntilReset = durationpb.New(result.Reset)
+		if !result.Allowed {
+			descriptorStatus.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+			response.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+	}
+
+	return response, nil
+}
+
+// currentLimit describes a limit to Envoy. Periods that are not a whole
+// unit are reported by name only.
+func currentLimit(limit ratelimit.Limit) *rlsv3.RateLimitResponse_RateLimit {
+	units := map[time.Duration]rlsv3.RateLimitResponse_RateLimit_Unit{
+		time.Second:    rlsv3.RateLimitResponse_RateLimit_SECOND,
+		time.Minute:    rlsv3.RateLimitResponse_RateLimit_MINUTE,
+		time.Hour:      rlsv3.RateLimitResponse_RateLimit_HOUR,
+		24 * time.Hour: rlsv3.RateLimitResponse_RateLimit_DAY,
+	}
+	return &rlsv3.RateLimitResponse_RateLimit{
+		Name:            fmt.Sprintf("%d/%s", limit.Requests, limit.Period),
+		RequestsPerUnit: uint32(limit.Requests),
+		Unit:            units[limit.Period],
+	}
+}
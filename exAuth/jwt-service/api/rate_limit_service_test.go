@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+	"github.com/vishalk17/jwt-service/ratelimit"
+)
+
+func newRateLimitRequest(entries ...[2]string) *rlsv3.RateLimitRequest {
+	descriptor := &ratelimitv3.RateLimitDescriptor{}
+	for _, entry := range entries {
+		descriptor.Entries = append(descriptor.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: entry[0], Value: entry[1]})
+	}
+	return &rlsv3.RateLimitRequest{Domain: "jwt-service", Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor}}
+}
+
+func TestShouldRateLimitWithoutCustomer(t *testing.T) {
+	server := newRateLimitServer(auth.NewJWTService(&db.Database{DB: nil}), &customerQuotas{limiter: ratelimit.NewMemoryLimiter()}, "")
+
+	resp, err := server.ShouldRateLimit(context.Background(), newRateLimitRequest([2]string{"remote_address", "10.0.0.1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.GetOverallCode())
+	assert.Len(t, resp.GetStatuses(), 1)
+	assert.Nil(t, resp.GetStatuses()[0].GetCurrentLimit())
+}
+
+func TestShouldRateLimitOff(t *testing.T) {
+	server := newRateLimitServer(auth.NewJWTService(&db.Database{DB: nil}), &customerQuotas{}, "tenant")
+
+	resp, err := server.ShouldRateLimit(context.Background(), newRateLimitRequest([2]string{"tenant", "acme"}))
+	assert.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.GetOverallCode())
+}
+
+func TestShouldRateLimitChargesCustomerOnce(t *testing.T) {
+	jwtService := auth.NewJWTService(db.NewMemoryStore())
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", RateLimitRequests: 2, RateLimitPeriodSeconds: 60})
+	require.NoError(t, err)
+	server := newRateLimitServer(jwtService, &customerQuotas{limiter: ratelimit.NewMemoryLimiter()}, "")
+
+	// Two descriptors of the same customer take one request from its quota
+	req := newRateLimitRequest([2]string{"customer_id", "acme"})
+	req.Descriptors = append(req.Descriptors, newRateLimitRequest([2]string{"customer_id", "acme"}, [2]string{"path", "/orders"}).Descriptors...)
+
+	resp, err := server.ShouldRateLimit(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.GetOverallCode())
+	for _, descriptorStatus := range resp.GetStatuses() {
+		assert.Equal(t, uint32(1), descriptorStatus.GetLimitRemaining())
+	}
+
+	resp, err = server.ShouldRateLimit(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OK, resp.GetOverallCode())
+
+	resp, err = server.ShouldRateLimit(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, rlsv3.RateLimitResponse_OVER_LIMIT, resp.GetOverallCode())
+	for _, descriptorStatus := range resp.GetStatuses() {
+		assert.Equal(t, rlsv3.RateLimitResponse_OVER_LIMIT, descriptorStatus.GetCode())
+	}
+}
+
+func TestCurrentLimit(t *testing.T) {
+	limit := currentLimit(ratelimit.Limit{Requests: 100, Period: time.Minute})
+	assert.Equal(t, rlsv3.RateLimitResponse_RateLimit_MINUTE, limit.GetUnit())
+	assert.Equal(t, uint32(100), limit.GetRequestsPerUnit())
+
+	limit = currentLimit(ratelimit.Limit{Requests: 5, Period: 30 * time.Second})
+	assert.Equal(t, rlsv3.RateLimitResponse_RateLimit_UNKNOWN, limit.GetUnit())
+	assert.Equal(t, "5/30s", limit.GetName())
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+	"github.com/vishalk17/jwt-service/ratelimit"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	headers := rateLimitHeaders(ratelimit.Result{Allowed: true, Limit: 100, Remaining: 99, Reset: 600 * time.Millisecond})
+	assert.Equal(t, [][2]string{
+		{"X-RateLimit-Limit", "100"},
+		{"X-RateLimit-Remaining", "99"},
+		{"X-RateLimit-Reset", "1"},
+	}, headers)
+
+	headers = rateLimitHeaders(ratelimit.Result{Limit: 100, RetryAfter: 1500 * time.Millisecond, Reset: time.Minute})
+	assert.Contains(t, headers, [2]string{"Retry-After", "2"})
+	assert.Contains(t, headers, [2]string{"X-RateLimit-Reset", "60"})
+}
+
+// unavailableLimiter fails like a bucket store that cannot be reached
+type unavailableLimiter struct{}
+
+func (unavailableLimiter) AllowN(string, ratelimit.Limit, int) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestCheckRateLimitFailureMode(t *testing.T) {
+	jwtService := auth.NewJWTService(db.NewMemoryStore())
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", RateLimitRequests: 10})
+	require.NoError(t, err)
+
+	t.Setenv("RATE_LIMIT_FAILURE_MODE", "")
+	quotas, err := newCustomerQuotas(unavailableLimiter{})
+	require.NoError(t, err)
+	_, limited, err := quotas.checkRateLimit(jwtService, "acme")
+	assert.NoError(t, err)
+	assert.False(t, limited)
+	assert.Equal(t, RateLimitStats{FailureMode: "open", Failures: 1}, quotas.stats())
+
+	t.Setenv("RATE_LIMIT_FAILURE_MODE", "closed")
+	quotas, err = newCustomerQuotas(unavailableLimiter{})
+	require.NoError(t, err)
+	_, _, err = quotas.checkRateLimit(jwtService, "acme")
+	assert.ErrorIs(t, err, errRateLimitUnavailable)
+	assert.Equal(t, RateLimitStats{FailureMode: "closed", Failures: 1}, quotas.stats())
+
+	t.Setenv("RATE_LIMIT_FAILURE_MODE", "sometimes")
+	_, err = newCustomerQuotas(unavailableLimiter{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"log"
+	"os"
+
+	"github.com/vishalk17/jwt-service/db"
+)
+
+// loadSecretCipher loads the master key that encrypts signing secrets at
+// rest from MASTER_KEY or MASTER_KEY_FILE (base64, 32 bytes). While the
+// master key is rotated, PREVIOUS_MASTER_KEY or PREVIOUS_MASTER_KEY_FILE
+// still decrypts the secrets secrets-reencrypt has not moved yet.
+func loadSecretCipher() (*db.SecretCipher, error) {
+	secrets, err := db.LoadSecretCipher(
+		os.Getenv("MASTER_KEY"), os.Getenv("MASTER_KEY_FILE"),
+		os.Getenv("PREVIOUS_MASTER_KEY"), os.Getenv("PREVIOUS_MASTER_KEY_FILE"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if secrets == nil {
+		log.Println("No MASTER_KEY configured, signing secrets are stored unencrypted")
+	}
+	return secrets, nil
+}
@@ -3,13 +3,19 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/vishalk17/jwt-service/auth"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -37,6 +43,57 @@ func TestHealthHandler(t *testing.T) {
 	assert.Equal(t, "healthy", response["status"])
 }
 
+// unreachableStore fails every ping, like a database that is down
+type unreachableStore struct {
+	db.CustomerStore
+}
+
+func (unreachableStore) Ping() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandlerDatabase(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	health := func(jwtService *auth.JWTService) (int, map[string]interface{}) {
+		server := &Server{engine: gin.New(), adminEngine: gin.New(), jwtService: jwtService}
+		server.setupRoutes()
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/health", nil)
+		server.adminEngine.ServeHTTP(rec, req)
+
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return rec.Code, response
+	}
+
+	code, response := health(auth.NewJWTService(db.NewMemoryStore()))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", response["status"])
+	assert.Equal(t, "ok", response["database"])
+
+	code, response = health(auth.NewJWTService(unreachableStore{db.NewMemoryStore()}))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy", response["status"])
+	assert.Equal(t, "unreachable", response["database"])
+
+	// Cached keys keep verifying tokens during the grace period
+	jwtService := auth.NewJWTService(unreachableStore{db.NewMemoryStore()})
+	jwtService.ConfigureCache(auth.DefaultCacheTTL, time.Minute, auth.DefaultCacheSize)
+	code, response = health(jwtService)
+	assert.Equal(t, "unhealthy", response["status"])
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	code, response = health(jwtService)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "degraded", response["status"])
+}
+
 func TestGenerateTokenHandler(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	
@@ -98,4 +155,69 @@ func TestVerifyJWTHandler(t *testing.T) {
 	router.ServeHTTP(rec2, req2)
 	
 	assert.Equal(t, http.StatusOK, rec2.Code)
-}
\ No newline at end of file
+}
+
+func TestGenerateTokenHandlerValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := &Server{jwtService: auth.NewJWTService(&db.Database{DB: nil})}
+	router := gin.New()
+	router.POST("/token", server.generateTokenHandler)
+
+	cases := map[string]struct {
+		form   url.Values
+		status int
+		error  string
+	}{
+		"missing grant_type":    {url.Values{}, http.StatusBadRequest, "invalid_request"},
+		"unsupported grant":     {url.Values{"grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type"},
+		"missing refresh_token": {url.Values{"grant_type": {"refresh_token"}}, http.StatusBadRequest, "invalid_request"},
+		"missing credentials":   {url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		"invalid minutes":       {url.Values{"grant_type": {"client_credentials"}, "minutes": {"soon"}}, http.StatusBadRequest, "invalid_request"},
+		"negative minutes":      {url.Values{"grant_type": {"client_credentials"}, "minutes": {"-5"}}, http.StatusBadRequest, "invalid_request"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/token", strings.NewReader(tc.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			var response map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tc.error, response["error"])
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func(form url.Values, basicID, basicSecret string) *gin.Context {
+		req, _ := http.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basicID != "" {
+			req.SetBasicAuth(url.QueryEscape(basicID), url.QueryEscape(basicSecret))
+		}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+		return c
+	}
+
+	clientID, clientSecret, err := clientCredentials(newContext(url.Values{"client_id": {"form-id"}, "client_secret": {"form-secret"}}, "", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, "form-id", clientID)
+	assert.Equal(t, "form-secret", clientSecret)
+
+	clientID, clientSecret, err = clientCredentials(newContext(url.Values{}, "basic-id", "basic/secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, "basic-id", clientID)
+	assert.Equal(t, "basic/secret", clientSecret)
+
+	_, _, err = clientCredentials(newContext(url.Values{"client_secret": {"form-secret"}}, "basic-id", "basic-secret"))
+	assert.Error(t, err)
+}
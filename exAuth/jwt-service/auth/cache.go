@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+const (
+	// DefaultCacheTTL bounds how long a change made through another replica
+	// (or the CLI) takes to be enforced when change notifications are not
+	// available
+	DefaultCacheTTL = 30 * time.Second
+	// DefaultCacheSize is the number of entries each of the customer, key
+	// and active key caches holds
+	DefaultCacheSize = 10000
+
+	// degradedRetryInterval is how often an entry served past its TTL is
+	// reloaded while the database cannot be reached
+	degradedRetryInterval = 5 * time.Second
+)
+
+// CacheStats counts the lookups of customers and keys made while verifying
+// tokens
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Entries       int    `json:"entries"`
+	// StaleHits were served past the TTL, within the grace period, while
+	// the entry was reloaded
+	StaleHits       uint64 `json:"stale_hits"`
+	RefreshFailures uint64 `json:"refresh_failures"`
+	// DegradedVerifications are tokens accepted with cached data that could
+	// not be reloaded because the database was unreachable
+	DegradedVerifications uint64 `json:"degraded_verifications"`
+}
+
+type cacheCounters struct {
+	hits, misses, evictions, invalidations            atomic.Uint64
+	staleHits, refreshFailures, degradedVerifications atomic.Uint64
+}
+
+// ttlCache is a map bounded to size entries, evicting the least recently
+// used one, whose entries expire after ttl. A zero ttl disables it.
+//
+// For grace after expiring, an entry is still served while it is reloaded
+// in the background (stale-while-revalidate). If reloading fails the entry
+// keeps being served until the grace period ends, so that a database
+// outage shorter than grace does not fail every request.
+type ttlCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	name     string
+	ttl      time.Duration
+	grace    time.Duration
+	size     int
+	entries  map[K]*list.Element
+	order    *list.List // of *cacheEntry, most recently used first
+	counters *cacheCounters
+	// outage is told whether loads reach the database. While it is active,
+	// stale entries are served as degraded even before their own reload
+	// fails. Nil when not tracked.
+	outage *outage
+	// generation changes on every invalidation. Loads that started before
+	// one are not stored, they may have read what was just changed.
+	generation uint64
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key        K
+	value      V
+	expiresAt  time.Time
+	refreshing bool
+	failedAt   time.Time // of the first failed reload, zero if none failed
+	retryAt    time.Time
+}
+
+func newTTLCache[K comparable, V any](name string, ttl, grace time.Duration, size int, counters *cacheCounters) *ttlCache[K, V] {
+	return &ttlCache[K, V]{
+		name:     name,
+		ttl:      ttl,
+		grace:    grace,
+		size:     size,
+		entries:  make(map[K]*list.Element),
+		order:    list.New(),
+		counters: counters,
+	}
+}
+
+// getOrLoad returns the cached value of key, or loads and caches it. Errors
+// are not cached. degraded is true when the value is served past its TTL
+// because reloading it failed.
+func (c *ttlCache[K, V]) getOrLoad(key K, load func() (V, error)) (value V, degraded bool, err error) {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry[K, V])
+		now := time.Now()
+		switch {
+		case now.Before(entry.expiresAt):
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			c.counters.hits.Add(1)
+			return entry.value, false, nil
+		case now.Before(entry.expiresAt.Add(c.grace)):
+			c.order.MoveToFront(element)
+			if !entry.refreshing && !now.Before(entry.retryAt) {
+				entry.refreshing = true
+				go c.refresh(entry, load, c.generation)
+			}
+			value, degraded = entry.value, !entry.failedAt.IsZero() || (c.outage != nil && c.outage.active())
+			c.mu.Unlock()
+			c.counters.staleHits.Add(1)
+			return value, degraded, nil
+		}
+		c.removeElement(element)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	c.counters.misses.Add(1)
+	value, err = load()
+	c.loaded(err)
+	if err != nil {
+		return value, false, err
+	}
+
+	c.store(key, value, generation)
+	return value, false, nil
+}
+
+// refresh reloads an entry served past its TTL. Entries that no longer
+// exist are dropped; on other errors the entry is kept for its grace
+// period and retried after degradedRetryInterval.
+func (c *ttlCache[K, V]) refresh(entry *cacheEntry[K, V], load func() (V, error), generation uint64) {
+	value, err := load()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.counters.refreshFailures.Add(1)
+	}
+	c.loaded(err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refreshing = false
+
+	element, ok := c.entries[entry.key]
+	if !ok || element.Value != entry {
+		return
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.removeElement(element)
+	case err != nil:
+		now := time.Now()
+		if entry.failedAt.IsZero() {
+			entry.failedAt = now
+			log.Printf("Failed to reload cached %s %v, serving it until %s: %v",
+				c.name, entry.key, entry.expiresAt.Add(c.grace).Format(time.RFC3339), err)
+		}
+		entry.retryAt = now.Add(degradedRetryInterval)
+	case generation == c.generation:
+		element.Value = &cacheEntry[K, V]{key: entry.key, value: value, expiresAt: time.Now().Add(c.ttl)}
+	}
+}
+
+// loaded tells the outage tracker whether a load reached the database. A
+// missing row is an answer from it.
+func (c *ttlCache[K, V]) loaded(err error) {
+	switch {
+	case c.outage == nil:
+	case err == nil || errors.Is(err, sql.ErrNoRows):
+		c.outage.recovered()
+	default:
+		c.outage.failed()
+	}
+}
+
+// store caches a loaded value unless the cache was invalidated since the
+// load started
+func (c *ttlCache[K, V]) store(key K, value V, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 || c.size <= 0 || generation != c.generation {
+		return
+	}
+
+	entry := &cacheEntry[K, V]{key: key, value: value, expiresAt: time.Now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+		c.counters.evictions.Add(1)
+	}
+}
+
+// removeIf drops the entries matching remove, or all entries when remove
+// is nil
+func (c *ttlCache[K, V]) removeIf(remove func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*cacheEntry[K, V])
+		if remove == nil || remove(entry.key, entry.value) {
+			c.removeElement(element)
+		}
+		element = next
+	}
+}
+
+func (c *ttlCache[K, V]) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry[K, V]).key)
+}
+
+// servable reports whether any entry can still be served, fresh or within
+// its grace period
+func (c *ttlCache[K, V]) servable() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, element := range c.entries {
+		if now.Before(element.Value.(*cacheEntry[K, V]).expiresAt.Add(c.grace)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ttlCache[K, V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// customerCache keeps the customers and keys VerifyToken needs in memory, so
+// that verifying a token does not cost database round trips. Cached values
+// are shared and must not be modified.
+type customerCache struct {
+	counters   cacheCounters
+	grace      time.Duration
+	outage     outage
+	customers  *ttlCache[string, *models.Customer]
+	keys       *ttlCache[string, *models.CustomerKey] // by kid
+	activeKeys *ttlCache[string, *models.CustomerKey] // by customer ID
+}
+
+func newCustomerCache(ttl, grace time.Duration, size int) *customerCache {
+	c := &customerCache{grace: grace}
+	c.customers = newTTLCache[string, *models.Customer]("customer", ttl, grace, size, &c.counters)
+	c.keys = newTTLCache[string, *models.CustomerKey]("signing key", ttl, grace, size, &c.counters)
+	c.activeKeys = newTTLCache[string, *models.CustomerKey]("active key of customer", ttl, grace, size, &c.counters)
+	c.customers.outage = &c.outage
+	c.keys.outage = &c.outage
+	c.activeKeys.outage = &c.outage
+	return c
+}
+
+// canVerify reports whether cached keys can still verify tokens without the
+// database
+func (c *customerCache) canVerify() bool {
+	return c.keys.servable() || c.activeKeys.servable()
+}
+
+// invalidate drops the customer and its keys. An empty customerID drops
+// everything.
+func (c *customerCache) invalidate(customerID string) {
+	c.counters.invalidations.Add(1)
+	if customerID == "" {
+		c.customers.removeIf(nil)
+		c.keys.removeIf(nil)
+		c.activeKeys.removeIf(nil)
+		return
+	}
+
+	byCustomer := func(id string, _ *models.Customer) bool { return id == customerID }
+	keyOfCustomer := func(_ string, key *models.CustomerKey) bool { return key.CustomerID == customerID }
+	c.customers.removeIf(byCustomer)
+	c.keys.removeIf(keyOfCustomer)
+	c.activeKeys.removeIf(keyOfCustomer)
+}
+
+func (c *customerCache) stats() CacheStats {
+	return CacheStats{
+		Hits:          c.counters.hits.Load(),
+		Misses:        c.counters.misses.Load(),
+		Evictions:     c.counters.evictions.Load(),
+		Invalidations: c.counters.invalidations.Load(),
+		Entries:       c.customers.len() + c.keys.len() + c.activeKeys.len(),
+
+		StaleHits:             c.counters.staleHits.Load(),
+		RefreshFailures:       c.counters.refreshFailures.Load(),
+		DegradedVerifications: c.counters.degradedVerifications.Load(),
+	}
+}
+
+// ConfigureCache replaces the customer and key cache with one keeping up to
+// size entries of each kind for ttl. A zero ttl disables caching. For grace
+// after expiring, entries are served while they are reloaded, and while the
+// database is unreachable; a zero grace fails closed as soon as they expire.
+func (j *JWTService) ConfigureCache(ttl, grace time.Duration, size int) {
+	j.cache = newCustomerCache(ttl, grace, size)
+}
+
+// CacheStats returns the hit, miss and invalidation counts of the customer
+// and key cache
+func (j *JWTService) CacheStats() CacheStats {
+	return j.cache.stats()
+}
+
+// ListenForChanges drops customers and keys from the cache as soon as the
+// store reports they changed, until ctx is done. Stores that cannot report
+// changes return an error; their changes are then picked up when cache
+// entries expire.
+func (j *JWTService) ListenForChanges(ctx context.Context) error {
+	notifier, ok := j.DB.(db.ChangeNotifier)
+	if !ok {
+		return errors.New("the store cannot notify changes")
+	}
+	return notifier.ListenForChanges(ctx, j.cache.invalidate)
+}
+
+// GetCustomer returns the customer, from the cache when possible. The
+// customer is shared with other callers and must not be modified.
+func (j *JWTService) GetCustomer(customerID string) (*models.Customer, error) {
+	customer, _, err := j.cachedCustomer(customerID)
+	return customer, err
+}
+
+// cachedCustomer returns the customer, from the cache when possible, and
+// whether it is served in degraded mode
+func (j *JWTService) cachedCustomer(customerID string) (*models.Customer, bool, error) {
+	return j.cache.customers.getOrLoad(customerID, func() (*models.Customer, error) {
+		return j.DB.GetCustomerByID(customerID)
+	})
+}
+
+// cachedActiveKey returns the customer's active key, from the cache when
+// possible, and whether it is served in degraded mode
+func (j *JWTService) cachedActiveKey(customerID string) (*models.CustomerKey, bool, error) {
+	return j.cache.activeKeys.getOrLoad(customerID, func() (*models.CustomerKey, error) {
+		return j.DB.GetActiveKeyForCustomer(customerID)
+	})
+}
+
+// cachedVerificationKey returns the key with the given kid if it may still
+// verify tokens, from the cache when possible, and whether it is served in
+// degraded mode
+func (j *JWTService) cachedVerificationKey(kid string) (*models.CustomerKey, bool, error) {
+	load := func() (*models.CustomerKey, error) {
+		return j.DB.GetVerificationKey(kid)
+	}
+
+	key, degraded, err := j.cache.keys.getOrLoad(kid, load)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The overlap window of a cached key may have ended since it was loaded
+	if key.Status == models.KeyStatusVerifying && key.VerifyUntil != nil && !time.Now().Before(*key.VerifyUntil) {
+		j.cache.keys.removeIf(func(id string, _ *models.CustomerKey) bool { return id == kid })
+		key, err = load()
+		return key, false, err
+	}
+
+	return key, degraded, nil
+}
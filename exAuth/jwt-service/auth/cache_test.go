@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestTTLCache(t *testing.T) {
+	counters := &cacheCounters{}
+	cache := newTTLCache[string, int]("test", time.Hour, 0, 2, counters)
+	loads := 0
+	load := func(value int) func() (int, error) {
+		return func() (int, error) {
+			loads++
+			return value, nil
+		}
+	}
+
+	value, _, _ := cache.getOrLoad("a", load(1))
+	assert.Equal(t, 1, value)
+	value, _, _ = cache.getOrLoad("a", load(2))
+	assert.Equal(t, 1, value)
+	assert.Equal(t, 1, loads)
+
+	// The least recently used entry is evicted
+	cache.getOrLoad("b", load(2))
+	cache.getOrLoad("a", load(1))
+	cache.getOrLoad("c", load(3))
+	assert.Equal(t, 2, cache.len())
+	value, _, _ = cache.getOrLoad("b", load(20))
+	assert.Equal(t, 20, value)
+
+	// Errors are not cached
+	_, _, err := cache.getOrLoad("d", func() (int, error) { return 0, errors.New("down") })
+	assert.Error(t, err)
+	value, _, _ = cache.getOrLoad("d", load(4))
+	assert.Equal(t, 4, value)
+
+	assert.Equal(t, uint64(2), counters.hits.Load())
+	assert.Equal(t, uint64(6), counters.misses.Load())
+	assert.Equal(t, uint64(3), counters.evictions.Load())
+}
+
+func TestTTLCacheInvalidationDuringLoad(t *testing.T) {
+	cache := newTTLCache[string, int]("test", time.Hour, 0, 10, &cacheCounters{})
+
+	// A value read before an invalidation may be stale and is not stored
+	value, _, _ := cache.getOrLoad("a", func() (int, error) {
+		cache.removeIf(nil)
+		return 1, nil
+	})
+	assert.Equal(t, 1, value)
+	assert.Equal(t, 0, cache.len())
+}
+
+func TestTTLCacheExpiry(t *testing.T) {
+	cache := newTTLCache[string, int]("test", time.Millisecond, 0, 10, &cacheCounters{})
+	cache.getOrLoad("a", func() (int, error) { return 1, nil })
+
+	time.Sleep(5 * time.Millisecond)
+	value, _, _ := cache.getOrLoad("a", func() (int, error) { return 2, nil })
+	assert.Equal(t, 2, value)
+
+	// A zero TTL caches nothing
+	cache = newTTLCache[string, int]("test", 0, 0, 10, &cacheCounters{})
+	cache.getOrLoad("a", func() (int, error) { return 1, nil })
+	assert.Equal(t, 0, cache.len())
+}
+
+// countingStore counts the customer lookups that reach the store
+type countingStore struct {
+	db.CustomerStore
+	customerLookups int
+}
+
+func (s *countingStore) GetCustomerByID(customerID string) (*models.Customer, error) {
+	s.customerLookups++
+	return s.CustomerStore.GetCustomerByID(customerID)
+}
+
+func TestVerifyTokenUsesCache(t *testing.T) {
+	store := &countingStore{CustomerStore: db.NewMemoryStore()}
+	jwtService := NewJWTService(store)
+
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+
+	lookups := store.customerLookups
+	for i := 0; i < 3; i++ {
+		_, err = jwtService.VerifyToken(tokenString)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, lookups+1, store.customerLookups)
+
+	stats := jwtService.CacheStats()
+	assert.Equal(t, uint64(4), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+
+	// A change notified by the store is enforced right away
+	assert.NoError(t, store.SetCustomerStatus("acme", models.CustomerStatusSuspended, ""))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	jwtService.cache.invalidate("acme")
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, ErrCustomerSuspended))
+	assert.Equal(t, uint64(1), jwtService.CacheStats().Invalidations)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+var (
+	// ErrInvalidAudience is returned by VerifyToken when the token was not
+	// issued for the expected audience
+	ErrInvalidAudience = errors.New("token is not valid for this audience")
+	// ErrInvalidTarget is returned by CreateCustomerJWTForAudience when a
+	// requested audience is not one of the service's audiences
+	ErrInvalidTarget = errors.New("audience not allowed")
+)
+
+// customerClaims builds the claims of a customer token. sub is the user when
+// the token is issued for one and the customer otherwise. accountId and
+// userId are only included when set so VerifyToken leaves them empty
+// otherwise. Scopes are written space separated into the scope claim
+// (RFC 8693). audience is the aud claim as returned by grantedAudience.
+func (j *JWTService) customerClaims(customer *models.Customer, userID string, scopes, audience []string, jti string, issuedAt, expiresAt time.Time) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"customerId": customer.CustomerID,
+		"sub":        customer.CustomerID,
+		"jti":        jti,
+		"exp":        expiresAt.Unix(),
+		"nbf":        issuedAt.Unix(),
+		"iat":        issuedAt.Unix(),
+	}
+	if customer.AccountID != "" {
+		claims["accountId"] = customer.AccountID
+	}
+	if userID != "" {
+		claims["userId"] = userID
+		claims["sub"] = userID
+	}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	if j.Issuer != "" {
+		claims["iss"] = j.Issuer
+	}
+	if len(audience) == 1 {
+		claims["aud"] = audience[0]
+	} else if len(audience) > 1 {
+		claims["aud"] = audience
+	}
+	return claims
+}
+
+// grantedAudience resolves the aud of a new token. No requested audience
+// selects all of the service's audiences; otherwise the token is narrowed to
+// the requested ones, which must all be audiences of the service.
+func (j *JWTService) grantedAudience(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return j.Audience, nil
+	}
+
+	for _, aud := range requested {
+		if !slices.Contains(j.Audience, aud) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTarget, aud)
+		}
+	}
+	return requested, nil
+}
+
+// parserOptions configures the registered claim checks done by the JWT
+// parser. exp is mandatory; nbf and iat are checked when present.
+func (j *JWTService) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(j.Leeway),
+	}
+	if j.Issuer != "" {
+		options = append(options, jwt.WithIssuer(j.Issuer))
+	}
+	return options
+}
+
+// checkAudience requires the token's aud to contain the expected audience,
+// or one of the service's audiences when none is given. Nothing is required
+// if neither is configured.
+func (j *JWTService) checkAudience(claims jwt.MapClaims, audience string) error {
+	expected := j.Audience
+	if audience != "" {
+		expected = []string{audience}
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	tokenAudience, err := claims.GetAudience()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAudience, err)
+	}
+	for _, aud := range expected {
+		if slices.Contains(tokenAudience, aud) {
+			return nil
+		}
+	}
+	return ErrInvalidAudience
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestCustomerClaims(t *testing.T) {
+	jwtService := &JWTService{Issuer: "https://jwt-service.example.com", Audience: []string{"gateway-a"}}
+	customer := &models.Customer{CustomerID: "test-customer", AccountID: "test-account"}
+	issuedAt := time.Now()
+	expiresAt := issuedAt.Add(time.Hour)
+
+	claims := jwtService.customerClaims(customer, "user-1", []string{"orders:read", "orders:write"}, jwtService.Audience, "jti-1", issuedAt, expiresAt)
+	assert.Equal(t, "test-customer", claims["customerId"])
+	assert.Equal(t, "test-account", claims["accountId"])
+	assert.Equal(t, "user-1", claims["userId"])
+	assert.Equal(t, "user-1", claims["sub"])
+	assert.Equal(t, "jti-1", claims["jti"])
+	assert.Equal(t, "orders:read orders:write", claims["scope"])
+	assert.Equal(t, "https://jwt-service.example.com", claims["iss"])
+	assert.Equal(t, "gateway-a", claims["aud"])
+	assert.Equal(t, issuedAt.Unix(), claims["iat"])
+	assert.Equal(t, issuedAt.Unix(), claims["nbf"])
+	assert.Equal(t, expiresAt.Unix(), claims["exp"])
+
+	// Tokens without a user are about the customer and carry no empty userId
+	claims = jwtService.customerClaims(customer, "", nil, nil, "jti-2", issuedAt, expiresAt)
+	assert.NotContains(t, claims, "userId")
+	assert.NotContains(t, claims, "scope")
+	assert.Equal(t, "test-customer", claims["sub"])
+
+	// Nothing is emitted for unconfigured issuer and audience
+	claims = (&JWTService{}).customerClaims(customer, "", nil, nil, "jti-3", issuedAt, expiresAt)
+	assert.NotContains(t, claims, "iss")
+	assert.NotContains(t, claims, "aud")
+}
+
+func TestGrantedAudience(t *testing.T) {
+	jwtService := &JWTService{Audience: []string{"gateway-a", "gateway-b"}}
+
+	audience, err := jwtService.grantedAudience(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gateway-a", "gateway-b"}, audience)
+
+	audience, err = jwtService.grantedAudience([]string{"gateway-b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gateway-b"}, audience)
+
+	_, err = jwtService.grantedAudience([]string{"gateway-b", "gateway-c"})
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+
+	// Nothing can be requested when the service has no audiences
+	_, err = (&JWTService{}).grantedAudience([]string{"gateway-a"})
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+}
+
+func TestCheckAudience(t *testing.T) {
+	jwtService := &JWTService{Audience: []string{"gateway-a", "gateway-b"}}
+	claims := jwt.MapClaims{"aud": []interface{}{"gateway-b", "gateway-c"}}
+
+	assert.NoError(t, jwtService.checkAudience(claims, ""))
+	assert.NoError(t, jwtService.checkAudience(claims, "gateway-c"))
+	assert.True(t, errors.Is(jwtService.checkAudience(claims, "gateway-d"), ErrInvalidAudience))
+	assert.True(t, errors.Is(jwtService.checkAudience(jwt.MapClaims{}, ""), ErrInvalidAudience))
+
+	// Without any configured audience tokens are not restricted
+	assert.NoError(t, (&JWTService{}).checkAudience(jwt.MapClaims{}, ""))
+}
+
+func TestVerifyTokenRegisteredClaims(t *testing.T) {
+	jwtService := &JWTService{Issuer: "https://jwt-service.example.com", Leeway: time.Minute}
+	key := []byte("test-secret")
+
+	parse := func(claims jwt.MapClaims) error {
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+		assert.NoError(t, err)
+		_, err = jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) { return key, nil }, jwtService.parserOptions()...)
+		return err
+	}
+
+	now := time.Now()
+	valid := jwt.MapClaims{"iss": "https://jwt-service.example.com", "exp": now.Add(time.Hour).Unix(), "iat": now.Unix()}
+	assert.NoError(t, parse(valid))
+
+	// Expired within the leeway is still accepted
+	assert.NoError(t, parse(jwt.MapClaims{"iss": "https://jwt-service.example.com", "exp": now.Add(-30 * time.Second).Unix()}))
+
+	assert.ErrorIs(t, parse(jwt.MapClaims{"iss": "https://jwt-service.example.com", "exp": now.Add(-2 * time.Minute).Unix()}), jwt.ErrTokenExpired)
+	assert.ErrorIs(t, parse(jwt.MapClaims{"iss": "https://jwt-service.example.com"}), jwt.ErrTokenRequiredClaimMissing)
+	assert.ErrorIs(t, parse(jwt.MapClaims{"iss": "https://other.example.com", "exp": now.Add(time.Hour).Unix()}), jwt.ErrTokenInvalidIssuer)
+	assert.ErrorIs(t, parse(jwt.MapClaims{"iss": "https://jwt-service.example.com", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(5 * time.Minute).Unix()}), jwt.ErrTokenNotValidYet)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// ErrInvalidClient is returned when OAuth2 client authentication fails
+var ErrInvalidClient = errors.New("invalid client credentials")
+
+// GenerateClientCredentials creates a new OAuth2 client ID and secret, and the
+// hash of the secret that is stored in place of it
+func GenerateClientCredentials() (clientID, clientSecret, clientSecretHash string, err error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	clientID = hex.EncodeToString(id)
+	clientSecret = base64.RawURLEncoding.EncodeToString(secret)
+	return clientID, clientSecret, hashSecret(clientSecret), nil
+}
+
+// AuthenticateClient checks OAuth2 client credentials and returns the
+// customer they belong to
+func (j *JWTService) AuthenticateClient(clientID, clientSecret string) (*models.Customer, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	customer, err := j.DB.GetCustomerByClientID(clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up client %s: %w", clientID, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(clientSecret)), []byte(customer.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	return customer, nil
+}
+
+// RotateClientCredentials issues new client credentials for a customer. The
+// previous secret stops working immediately.
+func (j *JWTService) RotateClientCredentials(customerID string) (string, string, error) {
+	clientID, clientSecret, clientSecretHash, err := GenerateClientCredentials()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client credentials: %w", err)
+	}
+
+	if err := j.DB.SetClientCredentials(customerID, clientID, clientSecretHash); err != nil {
+		return "", "", fmt.Errorf("failed to store client credentials for customer %s: %w", customerID, err)
+	}
+	j.cache.invalidate(customerID)
+
+	return clientID, clientSecret, nil
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+)
+
+func TestGenerateClientCredentials(t *testing.T) {
+	clientID, clientSecret, clientSecretHash, err := GenerateClientCredentials()
+	assert.NoError(t, err)
+	assert.Len(t, clientID, 32)
+	assert.NotEmpty(t, clientSecret)
+	assert.Equal(t, hashSecret(clientSecret), clientSecretHash)
+	assert.NotEqual(t, clientSecret, clientSecretHash)
+}
+
+func TestAuthenticateClientMissingCredentials(t *testing.T) {
+	jwtService := NewJWTService(&db.Database{DB: nil})
+
+	_, err := jwtService.AuthenticateClient("", "secret")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+
+	_, err = jwtService.AuthenticateClient("client", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
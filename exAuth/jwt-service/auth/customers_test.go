@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestValidateCustomer(t *testing.T) {
+	valid := func() *models.Customer {
+		return &models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60}
+	}
+	assert.NoError(t, ValidateCustomer(valid()))
+
+	tests := map[string]func(*models.Customer){
+		"missing customer ID":    func(c *models.Customer) { c.CustomerID = "" },
+		"missing account ID":     func(c *models.Customer) { c.AccountID = "" },
+		"zero expiration":        func(c *models.Customer) { c.ExpirationMinutes = 0 },
+		"negative max":           func(c *models.Customer) { c.MaxExpirationMinutes = -1 },
+		"negative rate limit":    func(c *models.Customer) { c.RateLimitRequests = -10 },
+		"negative rate interval": func(c *models.Customer) { c.RateLimitPeriodSeconds = -1 },
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			customer := valid()
+			modify(customer)
+			assert.True(t, errors.Is(ValidateCustomer(customer), ErrInvalidCustomer))
+		})
+	}
+}
+
+func TestCreateCustomerValidatesFirst(t *testing.T) {
+	// Invalid customers are rejected before the database is used
+	jwtService := &JWTService{}
+
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme"})
+	assert.True(t, errors.Is(err, ErrInvalidCustomer))
+
+	_, err = jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", SigningAlgorithm: "none"})
+	assert.True(t, errors.Is(err, ErrInvalidCustomer))
+}
+
+func TestCheckCustomerActive(t *testing.T) {
+	assert.NoError(t, checkCustomerActive(&models.Customer{Status: models.CustomerStatusActive}))
+	assert.NoError(t, checkCustomerActive(&models.Customer{}))
+	assert.True(t, errors.Is(checkCustomerActive(&models.Customer{Status: models.CustomerStatusSuspended}), ErrCustomerSuspended))
+	assert.True(t, errors.Is(checkCustomerActive(&models.Customer{Status: models.CustomerStatusDisabled}), ErrCustomerDisabled))
+	// States this version does not know about fail closed
+	assert.True(t, errors.Is(checkCustomerActive(&models.Customer{Status: "archived"}), ErrCustomerDisabled))
+}
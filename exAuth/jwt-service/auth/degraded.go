@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// Health states reported by JWTService.Health
+const (
+	HealthHealthy = "healthy"
+	// HealthDegraded means the database is unreachable but cached keys
+	// still verify tokens, until the last of them is past its grace period
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Health is the state of the token verification path
+type Health struct {
+	Status string
+	// DatabaseError is why the database is unreachable, nil when it is up
+	DatabaseError error
+	// DatabaseDownSince is when the database was first found unreachable
+	DatabaseDownSince *time.Time
+}
+
+// outage tracks since when the database has been unreachable
+type outage struct {
+	mu    sync.Mutex
+	since time.Time
+}
+
+// failed records that the database could not be reached and returns when
+// the outage started
+func (o *outage) failed() time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.since.IsZero() {
+		o.since = time.Now()
+	}
+	return o.since
+}
+
+// active reports whether the database is currently unreachable
+func (o *outage) active() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return !o.since.IsZero()
+}
+
+func (o *outage) recovered() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.since.IsZero() {
+		log.Printf("Database reachable again after %s", time.Since(o.since).Round(time.Second))
+		o.since = time.Time{}
+	}
+}
+
+// Health checks the database. While it is down the service is degraded as
+// long as any cached key is fresh or within its grace period, and so still
+// verifies tokens, and unhealthy once none is.
+func (j *JWTService) Health() Health {
+	err := j.DB.Ping()
+	if err == nil {
+		j.cache.outage.recovered()
+		return Health{Status: HealthHealthy}
+	}
+
+	since := j.cache.outage.failed()
+	health := Health{Status: HealthUnhealthy, DatabaseError: err, DatabaseDownSince: &since}
+	if j.cache.canVerify() {
+		health.Status = HealthDegraded
+	}
+	return health
+}
+
+// recordDegradedVerification leaves a trail of the tokens accepted with
+// cached data that could not be reloaded from the database
+func (j *JWTService) recordDegradedVerification(key *models.CustomerKey, jti string) {
+	j.cache.counters.degradedVerifications.Add(1)
+	log.Printf("Degraded mode: accepted token %s of customer %s signed with key %s using cached data, the database is unreachable",
+		jti, key.CustomerID, key.KID)
+}
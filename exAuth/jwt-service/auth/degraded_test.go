@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestTTLCacheStaleWhileRevalidate(t *testing.T) {
+	counters := &cacheCounters{}
+	cache := newTTLCache[string, int]("test", time.Millisecond, time.Hour, 10, counters)
+	cache.getOrLoad("a", func() (int, error) { return 1, nil })
+	time.Sleep(5 * time.Millisecond)
+
+	// Expired entries are served while they are reloaded
+	value, degraded, err := cache.getOrLoad("a", func() (int, error) { return 2, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	assert.False(t, degraded)
+	assert.Eventually(t, func() bool {
+		value, _, _ := cache.getOrLoad("a", func() (int, error) { return 2, nil })
+		return value == 2
+	}, time.Second, time.Millisecond)
+
+	// A failed reload keeps serving the entry, now in degraded mode
+	time.Sleep(5 * time.Millisecond)
+	cache.getOrLoad("a", func() (int, error) { return 0, errors.New("connection refused") })
+	assert.Eventually(t, func() bool { return counters.refreshFailures.Load() == 1 }, time.Second, time.Millisecond)
+	value, degraded, err = cache.getOrLoad("a", func() (int, error) { return 0, errors.New("connection refused") })
+	assert.NoError(t, err)
+	assert.Equal(t, 2, value)
+	assert.True(t, degraded)
+
+	// Entries that no longer exist are dropped
+	cache = newTTLCache[string, int]("test", time.Millisecond, time.Hour, 10, counters)
+	cache.getOrLoad("b", func() (int, error) { return 1, nil })
+	time.Sleep(5 * time.Millisecond)
+	cache.getOrLoad("b", func() (int, error) { return 0, sql.ErrNoRows })
+	assert.Eventually(t, func() bool { return cache.len() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestTTLCacheDegradedDuringOutage(t *testing.T) {
+	cache := newTTLCache[string, int]("test", time.Millisecond, time.Hour, 10, &cacheCounters{})
+	cache.outage = &outage{}
+	cache.getOrLoad("a", func() (int, error) { return 1, nil })
+	time.Sleep(5 * time.Millisecond)
+
+	// Once another lookup found the database down, stale entries are
+	// degraded before their own reload fails
+	cache.outage.failed()
+	_, degraded, err := cache.getOrLoad("a", func() (int, error) { return 0, errors.New("connection refused") })
+	assert.NoError(t, err)
+	assert.True(t, degraded)
+}
+
+func TestTTLCacheRecoversWithoutHealth(t *testing.T) {
+	down := errors.New("connection refused")
+	up := func() (int, error) { return 1, nil }
+	failing := func() (int, error) { return 0, down }
+
+	cache := newTTLCache[string, int]("test", time.Millisecond, time.Hour, 10, &cacheCounters{})
+	cache.outage = &outage{}
+	cache.getOrLoad("a", up)
+	cache.getOrLoad("b", up)
+	cache.getOrLoad("c", up)
+	time.Sleep(5 * time.Millisecond)
+
+	// A failed reload starts an outage, a successful one ends it
+	cache.getOrLoad("a", failing)
+	assert.Eventually(t, cache.outage.active, time.Second, time.Millisecond)
+	_, degraded, _ := cache.getOrLoad("b", up)
+	assert.True(t, degraded)
+	assert.Eventually(t, func() bool { return !cache.outage.active() }, time.Second, time.Millisecond)
+	_, degraded, err := cache.getOrLoad("c", up)
+	assert.NoError(t, err)
+	assert.False(t, degraded)
+
+	// So does a successful load of a missing entry
+	cache.outage.failed()
+	_, _, err = cache.getOrLoad("d", up)
+	assert.NoError(t, err)
+	assert.False(t, cache.outage.active())
+}
+
+// flakyStore fails customer and key lookups and pings while down is set
+type flakyStore struct {
+	db.CustomerStore
+	down atomic.Bool
+}
+
+var errDatabaseDown = errors.New("connection refused")
+
+func (s *flakyStore) GetCustomerByID(customerID string) (*models.Customer, error) {
+	if s.down.Load() {
+		return nil, errDatabaseDown
+	}
+	return s.CustomerStore.GetCustomerByID(customerID)
+}
+
+func (s *flakyStore) GetVerificationKey(kid string) (*models.CustomerKey, error) {
+	if s.down.Load() {
+		return nil, errDatabaseDown
+	}
+	return s.CustomerStore.GetVerificationKey(kid)
+}
+
+func (s *flakyStore) Ping() error {
+	if s.down.Load() {
+		return errDatabaseDown
+	}
+	return nil
+}
+
+func TestVerifyTokenDegraded(t *testing.T) {
+	store := &flakyStore{CustomerStore: db.NewMemoryStore()}
+	jwtService := NewJWTService(store)
+	jwtService.ConfigureCache(time.Millisecond, time.Hour, 100)
+
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, HealthHealthy, jwtService.Health().Status)
+
+	store.down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	// Cached keys keep verifying tokens and the trail records it
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return jwtService.CacheStats().RefreshFailures == 2 }, time.Second, time.Millisecond)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), jwtService.CacheStats().DegradedVerifications)
+
+	health := jwtService.Health()
+	assert.Equal(t, HealthDegraded, health.Status)
+	assert.Equal(t, errDatabaseDown, health.DatabaseError)
+
+	// Customers that were never cached fail closed
+	_, err = jwtService.GetCustomer("globex")
+	assert.Error(t, err)
+
+	store.down.Store(false)
+	assert.Equal(t, HealthHealthy, jwtService.Health().Status)
+}
+
+func TestHealthWithoutDegradedMode(t *testing.T) {
+	store := &flakyStore{CustomerStore: db.NewMemoryStore()}
+	jwtService := NewJWTService(store)
+
+	store.down.Store(true)
+	health := jwtService.Health()
+	assert.Equal(t, HealthUnhealthy, health.Status)
+	assert.NotNil(t, health.DatabaseDownSince)
+}
+
+func TestHealthFollowsCachedKeys(t *testing.T) {
+	store := &flakyStore{CustomerStore: db.NewMemoryStore()}
+	jwtService := NewJWTService(store)
+	jwtService.ConfigureCache(time.Millisecond, 50*time.Millisecond, 100)
+
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+
+	// An outage with nothing cached is unhealthy from the start
+	store.down.Store(true)
+	assert.Equal(t, HealthUnhealthy, jwtService.Health().Status)
+
+	// Keys cached after the outage started make it degraded again, until
+	// their grace period ends
+	store.down.Store(false)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	store.down.Store(true)
+	assert.Equal(t, HealthDegraded, jwtService.Health().Status)
+	assert.Eventually(t, func() bool { return jwtService.Health().Status == HealthUnhealthy }, time.Second, 5*time.Millisecond)
+}
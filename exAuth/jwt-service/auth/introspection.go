@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// IntrospectionResponse is an RFC 7662 token introspection response. Inactive
+// tokens only carry "active": false so nothing is disclosed about them.
+type IntrospectionResponse struct {
+	Active     bool   `json:"active"`
+	Scope      string `json:"scope,omitempty"`
+	Sub        string `json:"sub,omitempty"`
+	ClientID   string `json:"client_id,omitempty"`
+	TokenType  string `json:"token_type,omitempty"`
+	Exp        int64  `json:"exp,omitempty"`
+	Iat        int64  `json:"iat,omitempty"`
+	JTI        string `json:"jti,omitempty"`
+	CustomerID string `json:"customer_id,omitempty"`
+	AccountID  string `json:"account_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+}
+
+// CreateIntrospectionClient registers a service allowed to introspect tokens
+// and returns its client secret, which is not stored
+func (j *JWTService) CreateIntrospectionClient(name string) (*models.IntrospectionClient, string, error) {
+	clientID, clientSecret, clientSecretHash, err := GenerateClientCredentials()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate client credentials: %w", err)
+	}
+
+	client := &models.IntrospectionClient{
+		ClientID:         clientID,
+		ClientSecretHash: clientSecretHash,
+		Name:             name,
+	}
+	if err := j.DB.CreateIntrospectionClient(client); err != nil {
+		return nil, "", fmt.Errorf("failed to create introspection client: %w", err)
+	}
+
+	return client, clientSecret, nil
+}
+
+// AuthenticateIntrospectionClient checks the credentials of a caller of the
+// introspection endpoint
+func (j *JWTService) AuthenticateIntrospectionClient(clientID, clientSecret string) (*models.IntrospectionClient, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := j.DB.GetIntrospectionClient(clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up introspection client %s: %w", clientID, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(clientSecret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// Introspect verifies a token and describes it per RFC 7662. Any token that
+// fails verification is reported as inactive.
+func (j *JWTService) Introspect(tokenString string) *IntrospectionResponse {
+	payload, err := j.VerifyToken(tokenString)
+	if err != nil {
+		log.Printf("Introspected token is inactive: %v", err)
+		return &IntrospectionResponse{Active: false}
+	}
+
+	response := &IntrospectionResponse{
+		Active:     true,
+		Scope:      strings.Join(payload.Scopes, " "),
+		Sub:        payload.CustomerID,
+		TokenType:  "Bearer",
+		Exp:        payload.Exp,
+		Iat:        payload.Iat,
+		JTI:        payload.JTI,
+		CustomerID: payload.CustomerID,
+		AccountID:  payload.AccountID,
+		UserID:     payload.UserID,
+	}
+
+	// Tokens issued for a user are about that user
+	if payload.UserID != "" {
+		response.Sub = payload.UserID
+	}
+
+	// client_id is the OAuth2 client the token was issued to
+	customer, err := j.DB.GetCustomerByID(payload.CustomerID)
+	if err == nil {
+		response.ClientID = customer.ClientID
+	}
+
+	return response
+}
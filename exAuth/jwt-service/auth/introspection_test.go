@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+)
+
+func TestIntrospectInvalidToken(t *testing.T) {
+	jwtService := NewJWTService(&db.Database{DB: nil})
+
+	response := jwtService.Introspect("invalid.token.string")
+	assert.False(t, response.Active)
+
+	// Inactive responses must not disclose anything else
+	body, err := json.Marshal(response)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"active": false}`, string(body))
+}
+
+func TestAuthenticateIntrospectionClientMissingCredentials(t *testing.T) {
+	jwtService := NewJWTService(&db.Database{DB: nil})
+
+	_, err := jwtService.AuthenticateIntrospectionClient("", "")
+	assert.ErrorIs(t, err, ErrInvalidClient)
+}
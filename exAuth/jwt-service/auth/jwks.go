@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// JWK is a public JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK builds the public JWK for an asymmetric customer key, using the
+// key's stored kid so it matches the kid header of tokens it signed.
+func PublicJWK(customerKey *models.CustomerKey) (*JWK, error) {
+	jwk, err := publicJWK(customerKey.SigningAlgorithm, customerKey.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	jwk.Kid = customerKey.KID
+	return jwk, nil
+}
+
+// publicJWK builds the public JWK for asymmetric key material, without a kid
+func publicJWK(algorithm, secretKey string) (*JWK, error) {
+	if !IsAsymmetric(algorithm) {
+		return nil, fmt.Errorf("algorithm %s has no public key", algorithm)
+	}
+	publicKey, err := verificationKey(algorithm, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := &JWK{Use: "sig", Alg: algorithm}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64URL(key.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = base64URL(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64URL(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64URL(key)
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return jwk, nil
+}
+
+// keyID returns the kid of new key material. Asymmetric keys are identified
+// by the RFC 7638 thumbprint of their public key, so the kid is stable for a
+// given key and can be recomputed from the JWKS. HS256 secrets have no
+// public part and get a random kid.
+func keyID(algorithm, secretKey string) (string, error) {
+	if !IsAsymmetric(algorithm) {
+		return generateTokenID()
+	}
+
+	jwk, err := publicJWK(algorithm, secretKey)
+	if err != nil {
+		return "", err
+	}
+	return thumbprint(jwk)
+}
+
+// thumbprint computes the RFC 7638 SHA-256 thumbprint of a JWK
+func thumbprint(jwk *JWK) (string, error) {
+	// Required members only, in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64URL(sum[:]), nil
+}
+
+func base64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// publicKeySet builds a JWKS from the asymmetric keys in the list, skipping
+// HS256 secrets which must never be published
+func publicKeySet(customerKeys []*models.CustomerKey) (*JWKS, error) {
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, customerKey := range customerKeys {
+		if !IsAsymmetric(customerKey.SigningAlgorithm) {
+			continue
+		}
+		jwk, err := PublicJWK(customerKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build JWK for key %s: %w", customerKey.KID, err)
+		}
+		jwks.Keys = append(jwks.Keys, *jwk)
+	}
+	return jwks, nil
+}
+
+// JWKS returns every public key that may still verify tokens, including keys
+// of previous versions within their rotation overlap window
+func (j *JWTService) JWKS() (*JWKS, error) {
+	customerKeys, err := j.DB.ListVerificationKeys("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list verification keys: %w", err)
+	}
+	return publicKeySet(customerKeys)
+}
+
+// CustomerJWKS returns the public keys of a single customer
+func (j *JWTService) CustomerJWKS(customerID string) (*JWKS, error) {
+	customerKeys, err := j.DB.ListVerificationKeys(customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list verification keys for customer %s: %w", customerID, err)
+	}
+
+	jwks, err := publicKeySet(customerKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, fmt.Errorf("customer %s has no public keys", customerID)
+	}
+	return jwks, nil
+}
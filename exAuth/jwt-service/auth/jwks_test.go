@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestPublicJWK(t *testing.T) {
+	expected := map[string]string{
+		AlgorithmRS256: "RSA",
+		AlgorithmES256: "EC",
+		AlgorithmEdDSA: "OKP",
+	}
+
+	for algorithm, kty := range expected {
+		t.Run(algorithm, func(t *testing.T) {
+			secretKey, err := GenerateSigningKey(algorithm)
+			assert.NoError(t, err)
+
+			jwk, err := PublicJWK(&models.CustomerKey{
+				KID:              "test-kid",
+				SecretKey:        secretKey,
+				SigningAlgorithm: algorithm,
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, kty, jwk.Kty)
+			assert.Equal(t, algorithm, jwk.Alg)
+			assert.Equal(t, "sig", jwk.Use)
+			assert.Equal(t, "test-kid", jwk.Kid)
+
+			// New keys are identified by their thumbprint, which is stable
+			// for the same key material
+			kid, err := keyID(algorithm, secretKey)
+			assert.NoError(t, err)
+			expected, err := thumbprint(jwk)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, kid)
+			again, err := keyID(algorithm, secretKey)
+			assert.NoError(t, err)
+			assert.Equal(t, kid, again)
+		})
+	}
+}
+
+func TestPublicJWKSymmetric(t *testing.T) {
+	secretKey, err := GenerateSigningKey(AlgorithmHS256)
+	assert.NoError(t, err)
+
+	_, err = PublicJWK(&models.CustomerKey{SecretKey: secretKey, SigningAlgorithm: AlgorithmHS256})
+	assert.Error(t, err)
+
+	kid, err := keyID(AlgorithmHS256, secretKey)
+	assert.NoError(t, err)
+	assert.Len(t, kid, 32)
+}
+
+func TestThumbprintRFC7638(t *testing.T) {
+	// Example key from RFC 7638 section 3.1
+	jwk := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn6" +
+			"4tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91C" +
+			"bOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+
+	kid, err := thumbprint(jwk)
+	assert.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", kid)
+}
+
+func TestPublicKeySetSkipsSymmetricKeys(t *testing.T) {
+	hmacKey, err := GenerateSigningKey(AlgorithmHS256)
+	assert.NoError(t, err)
+	ecKey, err := GenerateSigningKey(AlgorithmES256)
+	assert.NoError(t, err)
+
+	jwks, err := publicKeySet([]*models.CustomerKey{
+		{KID: "hmac", SecretKey: hmacKey, SigningAlgorithm: AlgorithmHS256},
+		{KID: "ec", SecretKey: ecKey, SigningAlgorithm: AlgorithmES256},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "ec", jwks.Keys[0].Kid)
+}
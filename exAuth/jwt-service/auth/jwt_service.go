@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
@@ -27,13 +29,29 @@ func toIST(t time.Time) time.Time {
 	return t.In(istLocation)
 }
 
+// ErrUnknownUser is returned by CreateCustomerJWT when the user ID is not a
+// user of the customer
+var ErrUnknownUser = errors.New("unknown user for customer")
+
 type JWTService struct {
-	DB *db.Database
+	DB               db.CustomerStore
+	RefreshTokenTTL  time.Duration
+	MaxTokenLifetime time.Duration // service-wide ceiling on token lifetimes, 0 (the default) for none
+	Issuer           string        // iss of minted tokens, required on verification when set
+	Audience         []string      // aud of minted tokens, accepted by default on verification
+	Leeway           time.Duration // clock skew allowed when checking exp, nbf and iat
+	revocations      *revocationCache
+	cache            *customerCache
+	routeScopes      *reloadingValue[[]*models.RouteScope]
 }
 
-func NewJWTService(database *db.Database) *JWTService {
+func NewJWTService(store db.CustomerStore) *JWTService {
 	return &JWTService{
-		DB: database,
+		DB:              store,
+		RefreshTokenTTL: DefaultRefreshTokenTTL,
+		revocations:     newRevocationCache(store.ListRevokedTokens, revocationRefreshInterval),
+		cache:           newCustomerCache(DefaultCacheTTL, 0, DefaultCacheSize),
+		routeScopes:     newReloadingValue("route scopes", store.ListRouteScopes, routeScopeRefreshInterval),
 	}
 }
 
@@ -46,33 +64,98 @@ func GenerateSecretKey() (string, error) {
 	return base64.StdEncoding.EncodeToString(key), nil
 }
 
-// CreateCustomerJWT creates a JWT for a specific customer
-func (j *JWTService) CreateCustomerJWT(customerID string, expirationMinutes int) (string, error) {
-	// Get customer-specific secret key from database
-	secretKey, err := j.DB.GetSecretKeyForCustomer(customerID)
+// CreateCustomerJWT creates a JWT for a specific customer and returns it with
+// its expiry. userID is optional; when set it must be one of the customer's
+// users. scopes must be allowed for the customer; none grants all of them.
+// expirationMinutes of 0 uses the customer's default lifetime.
+func (j *JWTService) CreateCustomerJWT(customerID, userID string, scopes []string, expirationMinutes int) (string, time.Time, error) {
+	return j.CreateCustomerJWTForAudience(customerID, userID, scopes, nil, expirationMinutes)
+}
+
+// CreateCustomerJWTForAudience creates a JWT like CreateCustomerJWT whose aud
+// is narrowed to the given audiences. They must be audiences of the service;
+// none selects all of them.
+func (j *JWTService) CreateCustomerJWTForAudience(customerID, userID string, scopes, audience []string, expirationMinutes int) (string, time.Time, error) {
+	customer, err := j.DB.GetCustomerByID(customerID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get customer %s: %w", customerID, err)
+	}
+	if err := checkCustomerActive(customer); err != nil {
+		return "", time.Time{}, err
+	}
+
+	lifetime, err := j.tokenLifetime(customer, expirationMinutes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	scopes, err = grantedScopes(customer, scopes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	audience, err = j.grantedAudience(audience)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if userID != "" {
+		if _, err := j.DB.GetUser(customerID, userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return "", time.Time{}, fmt.Errorf("%w: %s", ErrUnknownUser, userID)
+			}
+			return "", time.Time{}, fmt.Errorf("failed to get user %s: %w", userID, err)
+		}
+	}
+
+	// Get the customer's active signing key from database
+	customerKey, err := j.DB.GetActiveKeyForCustomer(customerID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get secret key for customer %s: %w", customerID, err)
+	}
+
+	method, err := signingMethod(customerKey.SigningAlgorithm)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	key, err := signingKey(customerKey.SigningAlgorithm, customerKey.SecretKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to get secret key for customer %s: %w", customerID, err)
+		return "", time.Time{}, fmt.Errorf("failed to load signing key for customer %s: %w", customerID, err)
 	}
 
-	expirationTime := toIST(time.Now()).Add(time.Duration(expirationMinutes) * time.Minute)
+	// Unique token ID so a single token can be revoked
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate token ID: %w", err)
+	}
+
+	issuedAt := toIST(time.Now())
+	expirationTime := issuedAt.Add(lifetime)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"customerId": customerID,
-		"exp":        expirationTime.Unix(),
-		"iat":        toIST(time.Now()).Unix(),
-	})
+	token := jwt.NewWithClaims(method, j.customerClaims(customer, userID, scopes, audience, jti, issuedAt, expirationTime))
+	// The kid lets VerifyToken pick the right key version after a rotation
+	token.Header["kid"] = customerKey.KID
 
-	// Sign the token with the customer-specific secret key
-	tokenString, err := token.SignedString([]byte(secretKey))
+	// Sign the token with the customer-specific key
+	tokenString, err := token.SignedString(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expirationTime, nil
 }
 
-// VerifyToken verifies a JWT token using the customer-specific secret key
+// VerifyToken verifies a JWT token using the customer-specific secret key and
+// the service's default audience
 func (j *JWTService) VerifyToken(tokenString string) (*models.JWTPayload, error) {
+	return j.VerifyTokenForAudience(tokenString, "")
+}
+
+// VerifyTokenForAudience verifies a JWT token that must carry the given
+// audience, e.g. the audience of the route being accessed. An empty audience
+// falls back to the service's configured audiences.
+func (j *JWTService) VerifyTokenForAudience(tokenString, audience string) (*models.JWTPayload, error) {
 	// First, parse the token without verification to extract the customer ID
 	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
 	if err != nil {
@@ -90,20 +173,25 @@ func (j *JWTService) VerifyToken(tokenString string) (*models.JWTPayload, error)
 		return nil, fmt.Errorf("customerId not found in token")
 	}
 
-	// Get the customer-specific secret key from database
-	secretKey, err := j.DB.GetSecretKeyForCustomer(customerID)
+	// Get the customer-specific key from the cache or database
+	customerKey, keyDegraded, err := j.verificationKeyForToken(token, customerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get secret key for customer %s: %w", customerID, err)
+		return nil, err
+	}
+
+	key, err := verificationKey(customerKey.SigningAlgorithm, customerKey.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load verification key for customer %s: %w", customerID, err)
 	}
 
 	// Now verify the token with the customer-specific key
 	token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Validate the signing method against the key's algorithm
+		if token.Method.Alg() != customerKey.SigningAlgorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secretKey), nil
-	})
+		return key, nil
+	}, j.parserOptions()...)
 
 	if err != nil || !token.Valid {
 		return nil, fmt.Errorf("token verification failed: %w", err)
@@ -115,28 +203,140 @@ func (j *JWTService) VerifyToken(tokenString string) (*models.JWTPayload, error)
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
-	// Validate expiration
+	// exp, nbf, iat and iss were validated by the parser
+	if err := j.checkAudience(claims, audience); err != nil {
+		return nil, err
+	}
+
+	// Reject tokens on the denylist. Tokens minted before jti support
+	// cannot be revoked individually.
+	jti, _ := claims["jti"].(string)
+	if jti != "" {
+		revoked, err := j.revocations.IsRevoked(jti)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %w", err)
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	// Reject tokens of suspended customers and tokens issued before a
+	// customer-wide revocation
+	customer, customerDegraded, err := j.cachedCustomer(customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer %s: %w", customerID, err)
+	}
+	if err := checkCustomerActive(customer); err != nil {
+		return nil, err
+	}
+	if err := checkCustomerCutoff(customer, claims); err != nil {
+		return nil, err
+	}
+
+	if keyDegraded || customerDegraded {
+		j.recordDegradedVerification(customerKey, jti)
+	}
+
+	return payloadFromClaims(claims), nil
+}
+
+// ParseTokenUnverified reads a token's payload without checking its signature
+// or registered claims. It is only meant for offline tooling such as policy
+// testing; access decisions must use VerifyToken.
+func ParseTokenUnverified(tokenString string) (*models.JWTPayload, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if _, ok := claims["customerId"].(string); !ok {
+		return nil, fmt.Errorf("customerId not found in token")
+	}
+	return payloadFromClaims(claims), nil
+}
+
+// payloadFromClaims maps token claims to the payload handed to callers
+func payloadFromClaims(claims jwt.MapClaims) *models.JWTPayload {
+	payload := &models.JWTPayload{}
+	payload.CustomerID, _ = claims["customerId"].(string)
+	payload.JTI, _ = claims["jti"].(string)
+	payload.AccountID, _ = claims["accountId"].(string)
+	payload.UserID, _ = claims["userId"].(string)
+
+	if scope, ok := claims["scope"].(string); ok {
+		payload.Scopes = ParseScope(scope)
+	}
+
+	payload.Audience, _ = claims.GetAudience()
+
 	if exp, ok := claims["exp"].(float64); ok {
-		if time.Unix(int64(exp), 0).Before(time.Now()) {
-			return nil, fmt.Errorf("token expired")
+		payload.Exp = int64(exp)
+	}
+
+	if iat, ok := claims["iat"].(float64); ok {
+		payload.Iat = int64(iat)
+	}
+
+	return payload
+}
+
+// verificationKeyForToken selects the key a token must be verified with. Tokens
+// carrying a kid use that key version; tokens minted before key versioning
+// fall back to the customer's active key. degraded is true when the key is
+// served from the cache because the database is unreachable.
+func (j *JWTService) verificationKeyForToken(token *jwt.Token, customerID string) (key *models.CustomerKey, degraded bool, err error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		customerKey, degraded, err := j.cachedActiveKey(customerID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get secret key for customer %s: %w", customerID, err)
 		}
-	} else {
-		return nil, fmt.Errorf("expiration not found in token")
+		return customerKey, degraded, nil
 	}
 
-	// Create and return payload
-	payload := &models.JWTPayload{
-		CustomerID: customerID,
-		Exp:        int64(claims["exp"].(float64)),
+	customerKey, degraded, err := j.cachedVerificationKey(kid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("signing key %s is unknown or retired", kid)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get signing key %s: %w", kid, err)
 	}
 
-	if accountID, ok := claims["accountId"].(string); ok {
-		payload.AccountID = accountID
+	// A kid must never let one customer's key vouch for another customer
+	if customerKey.CustomerID != customerID {
+		return nil, false, fmt.Errorf("signing key %s does not belong to customer %s", kid, customerID)
 	}
 
-	if userID, ok := claims["userId"].(string); ok {
-		payload.UserID = userID
+	return customerKey, degraded, nil
+}
+
+// RotateCustomerKey generates a new active key for the customer. Tokens signed
+// with the previous key stay valid for the overlap window. An empty algorithm
+// keeps the customer's current algorithm.
+func (j *JWTService) RotateCustomerKey(customerID, algorithm string, overlap time.Duration) (*models.CustomerKey, error) {
+	if algorithm == "" {
+		current, err := j.DB.GetActiveKeyForCustomer(customerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active key for customer %s: %w", customerID, err)
+		}
+		algorithm = current.SigningAlgorithm
 	}
 
-	return payload, nil
-}
\ No newline at end of file
+	secretKey, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := keyID(algorithm, secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key ID: %w", err)
+	}
+
+	customerKey, err := j.DB.RotateCustomerKey(customerID, kid, secretKey, algorithm, overlap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate key for customer %s: %w", customerID, err)
+	}
+	j.cache.invalidate(customerID)
+
+	return customerKey, nil
+}
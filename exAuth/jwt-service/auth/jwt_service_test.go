@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
@@ -11,18 +13,36 @@ import (
 	"github.com/vishalk17/jwt-service/models"
 )
 
-// Mock Database for testing
+// Mock Database for testing. Methods that are not mocked panic through the
+// nil embedded store.
 type MockDatabase struct {
+	db.CustomerStore
 	mock.Mock
 }
 
-func (m *MockDatabase) GetSecretKeyForCustomer(customerID string) (string, error) {
+func (m *MockDatabase) GetSecretKeyForCustomer(customerID string) (string, string, error) {
 	args := m.Called(customerID)
-	return args.String(0), args.Error(1)
+	return args.String(0), args.String(1), args.Error(2)
 }
 
-func (m *MockDatabase) CreateCustomer(customer *models.Customer) error {
-	args := m.Called(customer)
+func (m *MockDatabase) GetActiveKeyForCustomer(customerID string) (*models.CustomerKey, error) {
+	args := m.Called(customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CustomerKey), args.Error(1)
+}
+
+func (m *MockDatabase) GetVerificationKey(kid string) (*models.CustomerKey, error) {
+	args := m.Called(kid)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.CustomerKey), args.Error(1)
+}
+
+func (m *MockDatabase) CreateCustomer(customer *models.Customer, kid string) error {
+	args := m.Called(customer, kid)
 	return args.Error(0)
 }
 
@@ -52,6 +72,14 @@ func (m *MockDatabase) DeleteCustomer(customerID string) error {
 	return args.Error(0)
 }
 
+func (m *MockDatabase) GetUser(customerID, userID string) (*models.User, error) {
+	args := m.Called(customerID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockDatabase) Close() {}
 
 func TestGenerateSecretKey(t *testing.T) {
@@ -65,25 +93,30 @@ func TestGenerateSecretKey(t *testing.T) {
 }
 
 func TestCreateCustomerJWT(t *testing.T) {
-	mockDB := new(MockDatabase)
-	jwtService := NewJWTService(&db.Database{DB: nil}) // We'll mock the DB calls
-	
-	// For this test, we'll need to use an actual database connection
-	// or create a more sophisticated mock that simulates the JWT functionality
-	
 	customerID := "test-customer-123"
 	secretKey, err := GenerateSecretKey()
 	assert.NoError(t, err)
 	
-	// Mock the GetSecretKeyForCustomer call
-	mockDB.On("GetSecretKeyForCustomer", customerID).Return(secretKey, nil)
-	
-	// Create a temporary JWT service with our mock
-	// Since we're just testing the signature verification, we'll use a real JWT
+	mockDB := new(MockDatabase)
+	mockDB.On("GetCustomerByID", customerID).Return(&models.Customer{
+		CustomerID:        customerID,
+		AccountID:         "test-account",
+		ExpirationMinutes: 5,
+		Status:            models.CustomerStatusActive,
+	}, nil)
+	mockDB.On("GetActiveKeyForCustomer", customerID).Return(&models.CustomerKey{
+		CustomerID:       customerID,
+		KID:              "kid-1",
+		SecretKey:        secretKey,
+		SigningAlgorithm: AlgorithmHS256,
+		Status:           models.KeyStatusActive,
+	}, nil)
+	jwtService := NewJWTService(mockDB)
 	
-	tokenString, err := createTokenWithKey(customerID, secretKey, 5) // 5 minutes
+	tokenString, expiresAt, err := jwtService.CreateCustomerJWT(customerID, "", nil, 0)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), expiresAt, 5*time.Second)
 	
 	// Verify we can parse the token structure
 	token, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
@@ -91,6 +124,9 @@ func TestCreateCustomerJWT(t *testing.T) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	assert.True(t, ok)
 	assert.Equal(t, customerID, claims["customerId"])
+	assert.Equal(t, "test-account", claims["accountId"])
+	assert.Equal(t, "kid-1", token.Header["kid"])
+	mockDB.AssertExpectations(t)
 }
 
 // Helper function to create a token with a specific key for testing
@@ -114,23 +150,126 @@ func TestVerifyToken(t *testing.T) {
 	
 	tokenString, err := createTokenWithKey(customerID, secretKey, 60) // 60 minutes
 	assert.NoError(t, err)
+	assert.NotEmpty(t, tokenString)
 	
-	// Mock the database to return our secret key
+	// Mock the database to return our secret key. The token has no kid, so
+	// the customer's active key is used.
 	mockDB := new(MockDatabase)
-	mockDB.On("GetSecretKeyForCustomer", customerID).Return(secretKey, nil)
-	
-	// Create JWT service with mocked database
-	// We need to create a temporary implementation since our JWTService
-	// uses the actual database connection
-	jwtService := &JWTService{
-		DB: &db.Database{DB: nil}, // We'll override the calls
-	}
+	mockDB.On("GetActiveKeyForCustomer", customerID).Return(&models.CustomerKey{
+		CustomerID:       customerID,
+		SecretKey:        secretKey,
+		SigningAlgorithm: AlgorithmHS256,
+		Status:           models.KeyStatusActive,
+	}, nil)
+	mockDB.On("GetCustomerByID", customerID).Return(&models.Customer{CustomerID: customerID, Status: models.CustomerStatusActive}, nil)
+	jwtService := NewJWTService(mockDB)
 	
-	// For this test we'll have to call the actual VerifyToken but with a
-	// modified approach since the real implementation calls the DB directly
+	payload, err := jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, customerID, payload.CustomerID)
 	
 	// Test with an invalid token
 	invalidToken, err := jwtService.VerifyToken("invalid.token.string")
 	assert.Error(t, err)
 	assert.Nil(t, invalidToken)
-}
\ No newline at end of file
+	
+	// A token signed with another key is rejected
+	otherKey, err := GenerateSecretKey()
+	assert.NoError(t, err)
+	forged, err := createTokenWithKey(customerID, otherKey, 60)
+	assert.NoError(t, err)
+	_, err = jwtService.VerifyToken(forged)
+	assert.Error(t, err)
+}
+
+func TestVerifyTokenStoreErrors(t *testing.T) {
+	customerID := "test-customer-789"
+	secretKey, err := GenerateSecretKey()
+	assert.NoError(t, err)
+	tokenString, err := createTokenWithKey(customerID, secretKey, 60)
+	assert.NoError(t, err)
+
+	mockDB := new(MockDatabase)
+	mockDB.On("GetActiveKeyForCustomer", customerID).Return(nil, errors.New("connection refused"))
+	jwtService := NewJWTService(mockDB)
+
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.ErrorContains(t, err, "connection refused")
+
+	// A deleted customer's tokens are rejected even though the key verifies
+	mockDB = new(MockDatabase)
+	mockDB.On("GetActiveKeyForCustomer", customerID).Return(&models.CustomerKey{
+		CustomerID:       customerID,
+		SecretKey:        secretKey,
+		SigningAlgorithm: AlgorithmHS256,
+	}, nil)
+	mockDB.On("GetCustomerByID", customerID).Return(nil, sql.ErrNoRows)
+	jwtService = NewJWTService(mockDB)
+
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestVerifyTokenLifecycle(t *testing.T) {
+	jwtService := NewJWTService(db.NewMemoryStore())
+
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+	payload, err := jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme-account", payload.AccountID)
+
+	// Suspension is reversible
+	assert.NoError(t, jwtService.SuspendCustomer("acme", "unpaid invoice"))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, ErrCustomerSuspended))
+	_, _, err = jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.True(t, errors.Is(err, ErrCustomerSuspended))
+	assert.NoError(t, jwtService.ResumeCustomer("acme"))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+
+	// Tokens signed with a retired key are rejected
+	_, err = jwtService.RotateCustomerKey("acme", "", 0)
+	assert.NoError(t, err)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.ErrorContains(t, err, "unknown or retired")
+
+	tokenString, _, err = jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, jwtService.RevokeToken(tokenString, "leaked"))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, ErrTokenRevoked))
+
+	// Disabling revokes every token, so resuming does not bring them back.
+	// The cutoff has second precision, so the token must predate it.
+	tokenString = mintTokenAt(t, jwtService, "acme", time.Now().Add(-time.Minute))
+	assert.NoError(t, jwtService.DisableCustomer("acme", "offboarded"))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, ErrCustomerDisabled))
+	assert.NoError(t, jwtService.ResumeCustomer("acme"))
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.True(t, errors.Is(err, ErrCustomerTokensRevoked))
+}
+
+// mintTokenAt signs a token of the customer as if it had been issued at
+// issuedAt
+func mintTokenAt(t *testing.T, jwtService *JWTService, customerID string, issuedAt time.Time) string {
+	customer, err := jwtService.DB.GetCustomerByID(customerID)
+	assert.NoError(t, err)
+	customerKey, err := jwtService.DB.GetActiveKeyForCustomer(customerID)
+	assert.NoError(t, err)
+	method, err := signingMethod(customerKey.SigningAlgorithm)
+	assert.NoError(t, err)
+	key, err := signingKey(customerKey.SigningAlgorithm, customerKey.SecretKey)
+	assert.NoError(t, err)
+
+	token := jwt.NewWithClaims(method, jwtService.customerClaims(customer, "", nil, jwtService.Audience, "", issuedAt, issuedAt.Add(time.Hour)))
+	token.Header["kid"] = customerKey.KID
+	tokenString, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return tokenString
+}
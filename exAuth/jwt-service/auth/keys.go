@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported customer token signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// DefaultAlgorithm is used for customers created without an explicit algorithm
+const DefaultAlgorithm = AlgorithmHS256
+
+// SupportedAlgorithms lists the signing algorithms a customer can be configured with
+var SupportedAlgorithms = []string{AlgorithmHS256, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+
+// IsAsymmetric reports whether tokens signed with the algorithm can be verified
+// with a public key only.
+func IsAsymmetric(algorithm string) bool {
+	return algorithm != AlgorithmHS256
+}
+
+// GenerateSigningKey creates the key material for a customer using the given
+// algorithm. HS256 keys are a base64 encoded shared secret (see
+// GenerateSecretKey); asymmetric keys are a PEM encoded PKCS#8 private key.
+func GenerateSigningKey(algorithm string) (string, error) {
+	var privateKey crypto.PrivateKey
+	var err error
+
+	switch algorithm {
+	case AlgorithmHS256:
+		return GenerateSecretKey()
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// signingMethod maps a customer algorithm to its jwt signing method
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// signingKey converts stored key material into the key used to sign tokens
+func signingKey(algorithm, secretKey string) (interface{}, error) {
+	if !IsAsymmetric(algorithm) {
+		return []byte(secretKey), nil
+	}
+	return parsePrivateKey(secretKey)
+}
+
+// verificationKey converts stored key material into the key used to verify
+// tokens. For asymmetric algorithms this is the public half of the key.
+func verificationKey(algorithm, secretKey string) (interface{}, error) {
+	if !IsAsymmetric(algorithm) {
+		return []byte(secretKey), nil
+	}
+	privateKey, err := parsePrivateKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey.Public(), nil
+}
+
+// PublicKeyPEM returns the PEM encoded public key for asymmetric key material
+func PublicKeyPEM(algorithm, secretKey string) (string, error) {
+	if !IsAsymmetric(algorithm) {
+		return "", fmt.Errorf("algorithm %s has no public key", algorithm)
+	}
+	publicKey, err := verificationKey(algorithm, secretKey)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func parsePrivateKey(secretKey string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(secretKey))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
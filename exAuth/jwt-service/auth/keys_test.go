@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSigningKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range SupportedAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			secretKey, err := GenerateSigningKey(algorithm)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, secretKey)
+
+			method, err := signingMethod(algorithm)
+			assert.NoError(t, err)
+			key, err := signingKey(algorithm, secretKey)
+			assert.NoError(t, err)
+
+			tokenString, err := jwt.NewWithClaims(method, jwt.MapClaims{
+				"customerId": "test-customer-123",
+				"exp":        time.Now().Add(time.Hour).Unix(),
+			}).SignedString(key)
+			assert.NoError(t, err)
+
+			publicKey, err := verificationKey(algorithm, secretKey)
+			assert.NoError(t, err)
+
+			parsed, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			}, jwt.WithValidMethods([]string{algorithm}))
+			assert.NoError(t, err)
+			assert.True(t, parsed.Valid)
+		})
+	}
+}
+
+func TestGenerateSigningKeyUnsupported(t *testing.T) {
+	_, err := GenerateSigningKey("none")
+	assert.Error(t, err)
+}
+
+func TestPublicKeyPEM(t *testing.T) {
+	secretKey, err := GenerateSigningKey(AlgorithmES256)
+	assert.NoError(t, err)
+
+	publicKey, err := PublicKeyPEM(AlgorithmES256, secretKey)
+	assert.NoError(t, err)
+	assert.Contains(t, publicKey, "BEGIN PUBLIC KEY")
+
+	hmacKey, err := GenerateSigningKey(AlgorithmHS256)
+	assert.NoError(t, err)
+	_, err = PublicKeyPEM(AlgorithmHS256, hmacKey)
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// defaultTokenLifetime is used when neither the request nor the customer sets
+// a lifetime
+const defaultTokenLifetime = 60 * time.Minute
+
+// ErrInvalidLifetime is returned for negative token lifetimes
+var ErrInvalidLifetime = errors.New("token lifetime must not be negative")
+
+// tokenLifetime resolves how long a new token for the customer is valid.
+// requestedMinutes of 0 selects the customer's expiration_minutes. Longer
+// lifetimes than the customer's maximum or the service ceiling, when one is
+// configured, are clamped.
+func (j *JWTService) tokenLifetime(customer *models.Customer, requestedMinutes int) (time.Duration, error) {
+	if requestedMinutes < 0 {
+		return 0, ErrInvalidLifetime
+	}
+
+	lifetime := time.Duration(requestedMinutes) * time.Minute
+	if lifetime == 0 {
+		lifetime = time.Duration(customer.ExpirationMinutes) * time.Minute
+	}
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	if customer.MaxExpirationMinutes > 0 {
+		lifetime = min(lifetime, time.Duration(customer.MaxExpirationMinutes)*time.Minute)
+	}
+	if j.MaxTokenLifetime > 0 {
+		lifetime = min(lifetime, j.MaxTokenLifetime)
+	}
+
+	return lifetime, nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestTokenLifetime(t *testing.T) {
+	jwtService := &JWTService{MaxTokenLifetime: 2 * time.Hour}
+
+	tests := map[string]struct {
+		customer  models.Customer
+		requested int
+		expected  time.Duration
+	}{
+		"customer default":           {models.Customer{ExpirationMinutes: 30}, 0, 30 * time.Minute},
+		"no customer default":        {models.Customer{}, 0, defaultTokenLifetime},
+		"requested":                  {models.Customer{ExpirationMinutes: 30}, 45, 45 * time.Minute},
+		"clamped to customer max":    {models.Customer{ExpirationMinutes: 30, MaxExpirationMinutes: 60}, 90, time.Hour},
+		"default clamped to max":     {models.Customer{ExpirationMinutes: 120, MaxExpirationMinutes: 60}, 0, time.Hour},
+		"clamped to service max":     {models.Customer{ExpirationMinutes: 30}, 600, 2 * time.Hour},
+		"customer max above ceiling": {models.Customer{MaxExpirationMinutes: 600}, 600, 2 * time.Hour},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lifetime, err := jwtService.tokenLifetime(&tc.customer, tc.requested)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, lifetime)
+		})
+	}
+
+	_, err := jwtService.tokenLifetime(&models.Customer{}, -1)
+	assert.True(t, errors.Is(err, ErrInvalidLifetime))
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// DefaultRefreshTokenTTL is how long a refresh token can be exchanged
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already exchanged refresh
+	// token is replayed; every token in its family has been revoked
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, all related refresh tokens have been revoked")
+)
+
+// generateRefreshToken creates an opaque refresh token and the hash stored
+// for it
+func generateRefreshToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashSecret(token), nil
+}
+
+// hashSecret hashes a random, high-entropy secret (refresh token or client
+// secret) for storage. A fast hash is sufficient because the secrets cannot
+// be guessed; it also keeps lookups by hash possible.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueRefreshToken starts a new refresh token family for the customer and,
+// if set, the user. Tokens minted from the family keep the same user,
+// requested scopes and requested audience.
+func (j *JWTService) IssueRefreshToken(customerID, userID string, scopes, audience []string) (string, error) {
+	token, tokenHash, err := generateRefreshToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	familyID, err := generateTokenID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token family: %w", err)
+	}
+
+	refresh := &models.RefreshToken{
+		FamilyID:   familyID,
+		CustomerID: customerID,
+		UserID:     userID,
+		Scopes:     scopes,
+		Audience:   audience,
+		ExpiresAt:  time.Now().Add(j.RefreshTokenTTL),
+	}
+	if err := j.DB.CreateRefreshToken(tokenHash, refresh); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// RefreshCustomerJWT exchanges a refresh token for a new access token and a
+// new refresh token. The presented refresh token cannot be used again. The
+// access token is minted before the refresh token is consumed, so that a
+// refresh that fails (e.g. because the customer is suspended, or the scope or
+// audience is no longer allowed) can be retried with the same refresh token.
+func (j *JWTService) RefreshCustomerJWT(refreshToken string, expirationMinutes int) (accessToken string, expiresAt time.Time, newRefreshToken string, err error) {
+	tokenHash := hashSecret(refreshToken)
+
+	refresh, err := j.DB.GetRefreshToken(tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, "", ErrInvalidRefreshToken
+	}
+	if err != nil && !errors.Is(err, db.ErrRefreshTokenReused) {
+		return "", time.Time{}, "", fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	// A replayed token goes straight to rotation, which revokes its family
+	if err == nil {
+		accessToken, expiresAt, err = j.CreateCustomerJWTForAudience(refresh.CustomerID, refresh.UserID, refresh.Scopes, refresh.Audience, expirationMinutes)
+		if err != nil {
+			return "", time.Time{}, "", err
+		}
+	}
+
+	newToken, newTokenHash, err := generateRefreshToken()
+	if err != nil {
+		return "", time.Time{}, "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refresh, err = j.DB.RotateRefreshToken(tokenHash, newTokenHash, time.Now().Add(j.RefreshTokenTTL))
+	if errors.Is(err, db.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected for customer %s, revoked token family", refresh.CustomerID)
+		return "", time.Time{}, "", ErrRefreshTokenReused
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", time.Time{}, "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	return accessToken, expiresAt, newToken, nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, tokenHash, err := generateRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.Len(t, tokenHash, 64)
+	assert.Equal(t, hashSecret(token), tokenHash)
+
+	other, otherHash, err := generateRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.NotEqual(t, tokenHash, otherHash)
+}
+
+func TestRefreshFailureKeepsRefreshToken(t *testing.T) {
+	jwtService := NewJWTService(db.NewMemoryStore())
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+
+	refreshToken, err := jwtService.IssueRefreshToken("acme", "", nil, nil)
+	assert.NoError(t, err)
+
+	// Failing to mint does not consume the refresh token, so retrying once
+	// the customer is resumed is not taken for reuse
+	assert.NoError(t, jwtService.SuspendCustomer("acme", "unpaid invoice"))
+	_, _, _, err = jwtService.RefreshCustomerJWT(refreshToken, 0)
+	assert.True(t, errors.Is(err, ErrCustomerSuspended))
+
+	assert.NoError(t, jwtService.ResumeCustomer("acme"))
+	_, _, _, err = jwtService.RefreshCustomerJWT(refreshToken, -1)
+	assert.True(t, errors.Is(err, ErrInvalidLifetime))
+	accessToken, _, newRefreshToken, err := jwtService.RefreshCustomerJWT(refreshToken, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, accessToken)
+
+	// The exchanged token is still detected when replayed
+	_, _, _, err = jwtService.RefreshCustomerJWT(refreshToken, 0)
+	assert.True(t, errors.Is(err, ErrRefreshTokenReused))
+	_, _, _, err = jwtService.RefreshCustomerJWT(newRefreshToken, 0)
+	assert.True(t, errors.Is(err, ErrInvalidRefreshToken))
+}
+
+func TestRefreshKeepsAudience(t *testing.T) {
+	jwtService := NewJWTService(db.NewMemoryStore())
+	jwtService.Audience = []string{"orders-api", "payments-api"}
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+
+	_, _, err = jwtService.CreateCustomerJWTForAudience("acme", "", nil, []string{"billing-api"}, 0)
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+
+	refreshToken, err := jwtService.IssueRefreshToken("acme", "", nil, []string{"payments-api"})
+	assert.NoError(t, err)
+
+	accessToken, _, _, err := jwtService.RefreshCustomerJWT(refreshToken, 0)
+	assert.NoError(t, err)
+	payload, err := jwtService.VerifyToken(accessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"payments-api"}, payload.Audience)
+
+	_, err = jwtService.VerifyTokenForAudience(accessToken, "orders-api")
+	assert.True(t, errors.Is(err, ErrInvalidAudience))
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// reloadingValue keeps a value loaded from the database in memory and reloads
+// it at most once per interval, so hot paths do not cost a database round
+// trip. It fails closed until the first successful load; after that a failed
+// reload keeps serving the last known value.
+type reloadingValue[T any] struct {
+	mu       sync.RWMutex
+	name     string
+	load     func() (T, error)
+	interval time.Duration
+	value    T
+	loaded   bool
+	loadedAt time.Time
+}
+
+func newReloadingValue[T any](name string, load func() (T, error), interval time.Duration) *reloadingValue[T] {
+	return &reloadingValue[T]{
+		name:     name,
+		load:     load,
+		interval: interval,
+	}
+}
+
+// Get returns the current value, reloading it first if it is stale. The
+// returned value must not be modified.
+func (r *reloadingValue[T]) Get() (T, error) {
+	r.mu.RLock()
+	if r.loaded && time.Since(r.loadedAt) < r.interval {
+		defer r.mu.RUnlock()
+		return r.value, nil
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded && time.Since(r.loadedAt) < r.interval {
+		return r.value, nil
+	}
+
+	value, err := r.load()
+	if err != nil {
+		// Without any value we cannot make a safe decision
+		if !r.loaded {
+			var zero T
+			return zero, fmt.Errorf("failed to load %s: %w", r.name, err)
+		}
+		// Otherwise keep serving the last known value and retry next interval
+		log.Printf("Failed to refresh %s, using cached value: %v", r.name, err)
+		r.loadedAt = time.Now()
+		return r.value, nil
+	}
+
+	r.value = value
+	r.loaded = true
+	r.loadedAt = time.Now()
+	return r.value, nil
+}
+
+// Update replaces the value with update(current) without waiting for a
+// reload. update must return a new value rather than modify the current one,
+// which readers may still hold.
+func (r *reloadingValue[T]) Update(update func(T) T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = update(r.value)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// ErrTokenRevoked is returned by VerifyToken for tokens on the jti denylist
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// ErrCustomerTokensRevoked is returned by VerifyToken for tokens issued before
+// the customer's tokens_valid_after cutoff
+var ErrCustomerTokensRevoked = errors.New("all tokens issued before the customer's revocation cutoff are revoked")
+
+// revocationRefreshInterval bounds how long a revocation made through another
+// replica (or the CLI) takes to be enforced by this process
+const revocationRefreshInterval = 30 * time.Second
+
+// revocationCache keeps the full set of unexpired revoked token IDs in memory
+// so that checking a token does not cost a database round trip
+type revocationCache struct {
+	revoked *reloadingValue[map[string]time.Time] // jti -> token expiry
+}
+
+func newRevocationCache(load func() (map[string]time.Time, error), interval time.Duration) *revocationCache {
+	return &revocationCache{
+		revoked: newReloadingValue("revoked tokens", load, interval),
+	}
+}
+
+// IsRevoked reports whether the token ID is on the denylist
+func (c *revocationCache) IsRevoked(jti string) (bool, error) {
+	revoked, err := c.revoked.Get()
+	if err != nil {
+		return false, err
+	}
+
+	expiresAt, ok := revoked[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// Add records a revocation made by this process without waiting for a reload
+func (c *revocationCache) Add(jti string, expiresAt time.Time) {
+	c.revoked.Update(func(current map[string]time.Time) map[string]time.Time {
+		revoked := make(map[string]time.Time, len(current)+1)
+		for id, expiry := range current {
+			revoked[id] = expiry
+		}
+		revoked[jti] = expiresAt
+		return revoked
+	})
+}
+
+// generateTokenID creates a random 128-bit token ID for the jti claim
+func generateTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// RevokeToken verifies a token and adds its jti to the denylist until the
+// token expires. Revoking an already revoked token succeeds.
+func (j *JWTService) RevokeToken(tokenString, reason string) error {
+	payload, err := j.VerifyToken(tokenString)
+	if errors.Is(err, ErrTokenRevoked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payload.JTI == "" {
+		return fmt.Errorf("token has no jti and cannot be revoked individually")
+	}
+
+	expiresAt := time.Unix(payload.Exp, 0)
+	if err := j.DB.RevokeToken(payload.JTI, payload.CustomerID, reason, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	j.revocations.Add(payload.JTI, expiresAt)
+	return nil
+}
+
+// RevokeAllCustomerTokens invalidates every token and refresh token issued to
+// the customer so far without rotating keys. Tokens minted afterwards are
+// unaffected.
+func (j *JWTService) RevokeAllCustomerTokens(customerID string) (time.Time, error) {
+	validAfter, err := j.DB.RevokeAllCustomerTokens(customerID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to revoke tokens for customer %s: %w", customerID, err)
+	}
+	j.cache.invalidate(customerID)
+	if err := j.DB.RevokeCustomerRefreshTokens(customerID); err != nil {
+		return time.Time{}, fmt.Errorf("failed to revoke refresh tokens for customer %s: %w", customerID, err)
+	}
+	return validAfter, nil
+}
+
+// checkCustomerCutoff rejects tokens issued before the customer's
+// tokens_valid_after cutoff. iat only has second precision, so the cutoff is
+// compared in whole seconds: tokens minted in the second of the cutoff stay
+// valid, which keeps tokens minted right after a revocation usable.
+func checkCustomerCutoff(customer *models.Customer, claims jwt.MapClaims) error {
+	if customer.TokensValidAfter == nil {
+		return nil
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return ErrCustomerTokensRevoked
+	}
+	if time.Unix(int64(iat), 0).Before(customer.TokensValidAfter.Truncate(time.Second)) {
+		return ErrCustomerTokensRevoked
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestRevocationCache(t *testing.T) {
+	loads := 0
+	cache := newRevocationCache(func() (map[string]time.Time, error) {
+		loads++
+		return map[string]time.Time{
+			"revoked-jti": time.Now().Add(time.Hour),
+			"expired-jti": time.Now().Add(-time.Minute),
+		}, nil
+	}, time.Minute)
+
+	revoked, err := cache.IsRevoked("revoked-jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = cache.IsRevoked("expired-jti")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = cache.IsRevoked("other-jti")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// The set is only loaded once per interval
+	assert.Equal(t, 1, loads)
+}
+
+func TestRevocationCacheAdd(t *testing.T) {
+	cache := newRevocationCache(func() (map[string]time.Time, error) {
+		return map[string]time.Time{}, nil
+	}, time.Minute)
+
+	revoked, err := cache.IsRevoked("new-jti")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	cache.Add("new-jti", time.Now().Add(time.Hour))
+
+	revoked, err = cache.IsRevoked("new-jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestRevocationCacheLoadFailure(t *testing.T) {
+	fail := true
+	cache := newRevocationCache(func() (map[string]time.Time, error) {
+		if fail {
+			return nil, errors.New("database unavailable")
+		}
+		return map[string]time.Time{"revoked-jti": time.Now().Add(time.Hour)}, nil
+	}, 0)
+
+	// Fails closed until a denylist has been loaded
+	_, err := cache.IsRevoked("revoked-jti")
+	assert.Error(t, err)
+
+	fail = false
+	revoked, err := cache.IsRevoked("revoked-jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	// Keeps the last known set when a refresh fails
+	fail = true
+	revoked, err = cache.IsRevoked("revoked-jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestGenerateTokenID(t *testing.T) {
+	first, err := generateTokenID()
+	assert.NoError(t, err)
+	second, err := generateTokenID()
+	assert.NoError(t, err)
+
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second)
+}
+
+func TestCheckCustomerCutoff(t *testing.T) {
+	cutoff := time.Now().Add(-time.Minute)
+	customer := &models.Customer{TokensValidAfter: &cutoff}
+
+	before := jwt.MapClaims{"iat": float64(cutoff.Add(-time.Hour).Unix())}
+	assert.ErrorIs(t, checkCustomerCutoff(customer, before), ErrCustomerTokensRevoked)
+
+	after := jwt.MapClaims{"iat": float64(cutoff.Add(time.Second).Unix())}
+	assert.NoError(t, checkCustomerCutoff(customer, after))
+
+	// iat has second precision, tokens of the cutoff's second are valid
+	sameSecond := jwt.MapClaims{"iat": float64(cutoff.Unix())}
+	assert.NoError(t, checkCustomerCutoff(customer, sameSecond))
+
+	missing := jwt.MapClaims{}
+	assert.ErrorIs(t, checkCustomerCutoff(customer, missing), ErrCustomerTokensRevoked)
+
+	// No cutoff means every token passes
+	assert.NoError(t, checkCustomerCutoff(&models.Customer{}, before))
+}
+
+func TestMintAfterRevokeAll(t *testing.T) {
+	jwtService := NewJWTService(db.NewMemoryStore())
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	assert.NoError(t, err)
+
+	_, err = jwtService.RevokeAllCustomerTokens("acme")
+	assert.NoError(t, err)
+
+	// A token minted in the same second as the revocation is not affected
+	tokenString, _, err := jwtService.CreateCustomerJWT("acme", "", nil, 0)
+	assert.NoError(t, err)
+	_, err = jwtService.VerifyToken(tokenString)
+	assert.NoError(t, err)
+}
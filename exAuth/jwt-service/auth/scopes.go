@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// ErrInvalidScope is returned by CreateCustomerJWT when a requested scope is
+// not allowed for the customer
+var ErrInvalidScope = errors.New("scope not allowed for customer")
+
+// routeScopeRefreshInterval bounds how long a route scope change takes to be
+// enforced by this process
+const routeScopeRefreshInterval = 30 * time.Second
+
+// ParseScope splits an OAuth2 scope string into its scopes
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// grantedScopes returns the scopes to write into a customer token. Without a
+// request every scope of the customer is granted; otherwise each requested
+// scope must be allowed for the customer.
+func grantedScopes(customer *models.Customer, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return customer.Scopes, nil
+	}
+
+	for _, scope := range requested {
+		if !slices.Contains(customer.Scopes, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	return requested, nil
+}
+
+// RequiredScope returns the scope a request must have been granted, or an
+// empty string if no route scope matches the request
+func (j *JWTService) RequiredScope(host, path, method string) (string, error) {
+	routes, err := j.routeScopes.Get()
+	if err != nil {
+		return "", err
+	}
+
+	if route := matchRouteScope(routes, host, path, method); route != nil {
+		return route.Scope, nil
+	}
+	return "", nil
+}
+
+// matchRouteScope finds the most specific route scope for a request: the
+// longest path prefix wins, then a matching host over any host, then a
+// matching method over any method.
+func matchRouteScope(routes []*models.RouteScope, host, path, method string) *models.RouteScope {
+	// Envoy passes the authority including any port and the path including
+	// the query string
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	path, _, _ = strings.Cut(path, "?")
+
+	var best *models.RouteScope
+	for _, route := range routes {
+		if route.Host != "" && !strings.EqualFold(route.Host, host) && !strings.EqualFold(route.Host, hostname) {
+			continue
+		}
+		if route.Method != "" && !strings.EqualFold(route.Method, method) {
+			continue
+		}
+		if !matchPathPrefix(path, route.PathPrefix) {
+			continue
+		}
+		if best == nil || moreSpecific(route, best) {
+			best = route
+		}
+	}
+	return best
+}
+
+// matchPathPrefix matches whole path segments, so that /api covers /api and
+// /api/orders but not /apiv2. A trailing slash on the prefix is ignored.
+func matchPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func moreSpecific(a, b *models.RouteScope) bool {
+	aPrefix, bPrefix := strings.TrimSuffix(a.PathPrefix, "/"), strings.TrimSuffix(b.PathPrefix, "/")
+	if len(aPrefix) != len(bPrefix) {
+		return len(aPrefix) > len(bPrefix)
+	}
+	if (a.Host != "") != (b.Host != "") {
+		return a.Host != ""
+	}
+	return a.Method != "" && b.Method == ""
+}
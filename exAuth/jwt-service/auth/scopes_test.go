@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestGrantedScopes(t *testing.T) {
+	customer := &models.Customer{Scopes: []string{"orders:read", "orders:write"}}
+
+	scopes, err := grantedScopes(customer, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders:read", "orders:write"}, scopes)
+
+	scopes, err = grantedScopes(customer, []string{"orders:read"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders:read"}, scopes)
+
+	_, err = grantedScopes(customer, []string{"orders:read", "admin"})
+	assert.True(t, errors.Is(err, ErrInvalidScope))
+}
+
+func TestMatchRouteScope(t *testing.T) {
+	routes := []*models.RouteScope{
+		{ID: 1, PathPrefix: "/", Scope: "default"},
+		{ID: 2, PathPrefix: "/orders", Scope: "orders:read"},
+		{ID: 3, PathPrefix: "/orders", Method: "POST", Scope: "orders:write"},
+		{ID: 4, Host: "admin.example.com", PathPrefix: "/orders", Scope: "orders:admin"},
+		{ID: 5, PathPrefix: "/orders/export", Scope: "orders:export"},
+		{ID: 6, PathPrefix: "/api/", Scope: "api"},
+	}
+
+	tests := map[string]struct {
+		host, path, method string
+		expected           int64
+	}{
+		"catch all":               {"www.example.com", "/health", "GET", 1},
+		"path prefix":             {"www.example.com", "/orders/42", "GET", 2},
+		"method":                  {"www.example.com", "/orders", "post", 3},
+		"host beats method":       {"admin.example.com:443", "/orders", "POST", 4},
+		"longest prefix":          {"admin.example.com", "/orders/export?format=csv", "GET", 5},
+		"query string is ignored": {"www.example.com", "/orders?id=1", "GET", 2},
+		"whole segments only":     {"www.example.com", "/ordersummary", "GET", 1},
+		"trailing slash":          {"www.example.com", "/api", "GET", 6},
+		"below trailing slash":    {"www.example.com", "/api/v1", "GET", 6},
+		"not a segment":           {"www.example.com", "/apiv2", "GET", 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			route := matchRouteScope(routes, tc.host, tc.path, tc.method)
+			if assert.NotNil(t, route) {
+				assert.Equal(t, tc.expected, route.ID)
+			}
+		})
+	}
+
+	assert.Nil(t, matchRouteScope(routes[1:], "www.example.com", "/health", "GET"))
+}
+
+func TestJWTPayloadHasScope(t *testing.T) {
+	payload := &models.JWTPayload{Scopes: []string{"orders:read"}}
+	assert.True(t, payload.HasScope("orders:read"))
+	assert.False(t, payload.HasScope("orders:write"))
+}
@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestGenerateTokenMaxLifetime(t *testing.T) {
+	require.NoError(t, rootCmd.PersistentFlags().Set("max-token-lifetime", "1h"))
+	t.Cleanup(func() { maxLifetime = 0 })
+
+	jwtService := newJWTService(db.NewMemoryStore())
+	_, err := jwtService.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", ExpirationMinutes: 60})
+	require.NoError(t, err)
+
+	// jwt-generate --minutes 600 is clamped to the service-wide ceiling
+	_, expiresAt, err := jwtService.CreateCustomerJWTForAudience("acme", "", nil, nil, 600)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 5*time.Second)
+}
@@ -1,94 +1,298 @@
 package db
 
 import (
+    "context"
     "database/sql"
+    "errors"
+    "strings"
+    "time"
 
-    _ "github.com/lib/pq"
+    "github.com/lib/pq"
     "github.com/vishalk17/jwt-service/models"
 )
 
+// pingTimeout bounds health checks, which must answer while the database
+// is unreachable
+const pingTimeout = 2 * time.Second
+
+// ErrCustomerExists is returned by CreateCustomer when the customer ID or
+// account ID is already taken
+var ErrCustomerExists = errors.New("customer already exists")
+
 type Database struct {
     DB *sql.DB
+    // Secrets encrypts signing secrets at rest. Without it they are stored
+    // in plaintext.
+    Secrets *SecretCipher
+    sqlite bool // opened by NewSQLiteDatabase
+    url string // Postgres connection string, for the change listener
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation on
+// Postgres (unique_violation) or SQLite
+func isUniqueViolation(err error) bool {
+    var pqErr *pq.Error
+    if errors.As(err, &pqErr) {
+        return pqErr.Code == "23505"
+    }
+    return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// forUpdate locks the selected rows until the transaction ends. SQLite
+// connections are not shared, so there is nothing to lock.
+func (d *Database) forUpdate() string {
+    if d.sqlite {
+        return ""
+    }
+    return " FOR UPDATE"
+}
+
+// currentSecond is the current time truncated to whole seconds, the
+// precision of the iat claim tokens_valid_after is compared with. SQLite's
+// CURRENT_TIMESTAMP has no fractional seconds.
+func (d *Database) currentSecond() string {
+    if d.sqlite {
+        return "CURRENT_TIMESTAMP"
+    }
+    return "date_trunc('second', CURRENT_TIMESTAMP)"
 }
 
+// NewDatabase connects to Postgres and applies pending migrations. It
+// refuses to start against a schema migrated by a newer release.
 func NewDatabase(connectionString string) (*Database, error) {
-    db, err := sql.Open("postgres", connectionString)
+    database, err := connectPostgres(connectionString)
     if err != nil {
         return nil, err
     }
 
-    if err = db.Ping(); err != nil {
+    if _, err := database.MigrateUp(); err != nil {
+        database.Close()
         return nil, err
     }
 
-    // Create customers table if it doesn't exist
-    createTableQuery := `
-        CREATE TABLE IF NOT EXISTS customers (
-            id SERIAL PRIMARY KEY,
-            customer_id VARCHAR(255) UNIQUE NOT NULL,
-            account_id VARCHAR(255) UNIQUE NOT NULL,
-            secret_key TEXT NOT NULL,
-            expiration_minutes INTEGER DEFAULT 60,
-            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-        );
-    `
+    return database, nil
+}
+
+func connectPostgres(connectionString string) (*Database, error) {
+    db, err := sql.Open("postgres", connectionString)
+    if err != nil {
+        return nil, err
+    }
 
-    if _, err = db.Exec(createTableQuery); err != nil {
+    if err = db.Ping(); err != nil {
+        db.Close()
         return nil, err
     }
 
-    return &Database{DB: db}, nil
+    return &Database{DB: db, url: connectionString}, nil
 }
 
-func (d *Database) CreateCustomer(customer *models.Customer) error {
+// CreateCustomer inserts the customer together with its first (active) key,
+// identified by kid
+func (d *Database) CreateCustomer(customer *models.Customer, kid string) error {
+    secretKey, err := d.encryptSecret(customer.SecretKey, customer.CustomerID)
+    if err != nil {
+        return err
+    }
+
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
     query := `
-        INSERT INTO customers (customer_id, account_id, secret_key, expiration_minutes) 
-        VALUES ($1, $2, $3, $4) 
-        RETURNING id, created_at, updated_at
+        INSERT INTO customers (customer_id, account_id, secret_key, signing_algorithm, client_id, client_secret_hash, expiration_minutes, max_expiration_minutes, scopes, rate_limit_requests, rate_limit_period_seconds, rate_limit_burst) 
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10, $11, $12) 
+        RETURNING id, status, created_at, updated_at
     `
     
-    err := d.DB.QueryRow(query, 
+    err = tx.QueryRow(query, 
         customer.CustomerID, 
         customer.AccountID, 
-        customer.SecretKey, 
+        secretKey, 
+        customer.SigningAlgorithm,
+        customer.ClientID,
+        customer.ClientSecretHash,
         customer.ExpirationMinutes,
-    ).Scan(&customer.ID, &customer.CreatedAt, &customer.UpdatedAt)
-    
-    return err
+        customer.MaxExpirationMinutes,
+        strings.Join(customer.Scopes, " "),
+        customer.RateLimitRequests,
+        rateLimitPeriodSeconds(customer),
+        customer.RateLimitBurst,
+    ).Scan(&customer.ID, &customer.Status, &customer.CreatedAt, &customer.UpdatedAt)
+    if isUniqueViolation(err) {
+        return ErrCustomerExists
+    }
+    if err != nil {
+        return err
+    }
+
+    keyQuery := `
+        INSERT INTO customer_keys (customer_id, kid, version, secret_key, signing_algorithm, status)
+        VALUES ($1, $2, 1, $3, $4, 'active')
+    `
+
+    if _, err = tx.Exec(keyQuery, customer.CustomerID, kid, secretKey, customer.SigningAlgorithm); err != nil {
+        return err
+    }
+
+    return tx.Commit()
 }
 
-func (d *Database) GetCustomerByID(customerID string) (*models.Customer, error) {
-    query := `SELECT id, customer_id, account_id, expiration_minutes, created_at, updated_at FROM customers WHERE customer_id = $1`
-    
+const customerColumns = `id, customer_id, account_id, signing_algorithm, COALESCE(client_id, ''), COALESCE(client_secret_hash, ''), COALESCE(expiration_minutes, 60), max_expiration_minutes, scopes, rate_limit_requests, rate_limit_period_seconds, rate_limit_burst, status, status_reason, status_changed_at, tokens_valid_after, created_at, updated_at`
+
+func scanCustomer(row rowScanner) (*models.Customer, error) {
     customer := &models.Customer{}
-    err := d.DB.QueryRow(query, customerID).Scan(
+    var scopes string
+    var statusChangedAt, tokensValidAfter sql.NullTime
+
+    err := row.Scan(
         &customer.ID,
         &customer.CustomerID,
         &customer.AccountID,
+        &customer.SigningAlgorithm,
+        &customer.ClientID,
+        &customer.ClientSecretHash,
         &customer.ExpirationMinutes,
+        &customer.MaxExpirationMinutes,
+        &scopes,
+        &customer.RateLimitRequests,
+        &customer.RateLimitPeriodSeconds,
+        &customer.RateLimitBurst,
+        &customer.Status,
+        &customer.StatusReason,
+        &statusChangedAt,
+        &tokensValidAfter,
         &customer.CreatedAt,
         &customer.UpdatedAt,
     )
-    
     if err != nil {
         return nil, err
     }
-    
+
+    customer.Scopes = strings.Fields(scopes)
+    if statusChangedAt.Valid {
+        customer.StatusChangedAt = &statusChangedAt.Time
+    }
+    if tokensValidAfter.Valid {
+        customer.TokensValidAfter = &tokensValidAfter.Time
+    }
+
     return customer, nil
 }
 
-func (d *Database) GetSecretKeyForCustomer(customerID string) (string, error) {
-    query := `SELECT secret_key FROM customers WHERE customer_id = $1`
+func (d *Database) GetCustomerByID(customerID string) (*models.Customer, error) {
+    query := `SELECT ` + customerColumns + ` FROM customers WHERE customer_id = $1`
     
-    var secretKey string
-    err := d.DB.QueryRow(query, customerID).Scan(&secretKey)
+    return scanCustomer(d.DB.QueryRow(query, customerID))
+}
+
+// GetCustomerByClientID looks up a customer by its OAuth2 client ID
+func (d *Database) GetCustomerByClientID(clientID string) (*models.Customer, error) {
+    query := `SELECT ` + customerColumns + ` FROM customers WHERE client_id = $1`
+
+    return scanCustomer(d.DB.QueryRow(query, clientID))
+}
+
+// SetClientCredentials replaces the customer's client ID and secret hash
+func (d *Database) SetClientCredentials(customerID, clientID, clientSecretHash string) error {
+    query := `
+        UPDATE customers
+        SET client_id = $2, client_secret_hash = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+    `
+
+    result, err := d.DB.Exec(query, customerID, clientID, clientSecretHash)
+    if err != nil {
+        return err
+    }
+
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if updated == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// SetCustomerScopes replaces the scopes the customer's tokens may be granted.
+// Tokens already issued keep their scope until they expire.
+func (d *Database) SetCustomerScopes(customerID string, scopes []string) error {
+    query := `UPDATE customers SET scopes = $2, updated_at = CURRENT_TIMESTAMP WHERE customer_id = $1`
+
+    result, err := d.DB.Exec(query, customerID, strings.Join(scopes, " "))
+    if err != nil {
+        return err
+    }
+
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if updated == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// SetCustomerRateLimit replaces the customer's request quota. 0 requests
+// removes the limit.
+func (d *Database) SetCustomerRateLimit(customerID string, requests, periodSeconds, burst int) error {
+    query := `
+        UPDATE customers
+        SET rate_limit_requests = $2, rate_limit_period_seconds = $3, rate_limit_burst = $4, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+    `
+
+    result, err := d.DB.Exec(query, customerID, requests, periodSeconds, burst)
+    if err != nil {
+        return err
+    }
+
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if updated == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// rateLimitPeriodSeconds defaults an unset period to one second
+func rateLimitPeriodSeconds(customer *models.Customer) int {
+    if customer.RateLimitPeriodSeconds <= 0 {
+        return 1
+    }
+    return customer.RateLimitPeriodSeconds
+}
+
+// GetSecretKeyForCustomer returns the customer's decrypted key material and
+// the algorithm it is used with
+func (d *Database) GetSecretKeyForCustomer(customerID string) (string, string, error) {
+    query := `SELECT secret_key, signing_algorithm FROM customers WHERE customer_id = $1`
+    
+    var secretKey, algorithm string
+    if err := d.DB.QueryRow(query, customerID).Scan(&secretKey, &algorithm); err != nil {
+        return "", "", err
+    }
+
+    secretKey, err := d.decryptSecret(secretKey, customerID)
+    if err != nil {
+        return "", "", err
+    }
     
-    return secretKey, err
+    return secretKey, algorithm, nil
 }
 
 func (d *Database) ListCustomers() ([]*models.Customer, error) {
-    query := `SELECT id, customer_id, account_id, expiration_minutes, created_at, updated_at FROM customers ORDER BY created_at DESC`
+    query := `SELECT ` + customerColumns + ` FROM customers ORDER BY created_at DESC`
     
     rows, err := d.DB.Query(query)
     if err != nil {
@@ -98,15 +302,8 @@ func (d *Database) ListCustomers() ([]*models.Customer, error) {
     
     var customers []*models.Customer
     for rows.Next() {
-        customer := &models.Customer{}
-        if err := rows.Scan(
-            &customer.ID,
-            &customer.CustomerID,
-            &customer.AccountID,
-            &customer.ExpirationMinutes,
-            &customer.CreatedAt,
-            &customer.UpdatedAt,
-        ); err != nil {
+        customer, err := scanCustomer(rows)
+        if err != nil {
             return nil, err
         }
         customers = append(customers, customer)
@@ -115,28 +312,155 @@ func (d *Database) ListCustomers() ([]*models.Customer, error) {
     return customers, nil
 }
 
+// ListCustomersPage returns up to limit customers, newest first, skipping
+// the first offset
+func (d *Database) ListCustomersPage(limit, offset int) ([]*models.Customer, error) {
+    query := `SELECT ` + customerColumns + ` FROM customers ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2`
+
+    rows, err := d.DB.Query(query, limit, offset)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var customers []*models.Customer
+    for rows.Next() {
+        customer, err := scanCustomer(rows)
+        if err != nil {
+            return nil, err
+        }
+        customers = append(customers, customer)
+    }
+
+    return customers, rows.Err()
+}
+
+// SetCustomerStatus changes whether the customer can mint and use tokens and
+// records why and when
+func (d *Database) SetCustomerStatus(customerID, status, reason string) error {
+    query := `
+        UPDATE customers
+        SET status = $2, status_reason = $3, status_changed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+    `
+
+    result, err := d.DB.Exec(query, customerID, status, reason)
+    if err != nil {
+        return err
+    }
+
+    updated, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if updated == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// UpdateCustomer stores the customer's settings. Unknown customers return
+// sql.ErrNoRows.
 func (d *Database) UpdateCustomer(customer *models.Customer) error {
     query := `
         UPDATE customers 
-        SET account_id = $2, expiration_minutes = $3, updated_at = CURRENT_TIMESTAMP
+        SET account_id = $2, expiration_minutes = $3, max_expiration_minutes = $4, scopes = $5,
+            rate_limit_requests = $6, rate_limit_period_seconds = $7, rate_limit_burst = $8, updated_at = CURRENT_TIMESTAMP
         WHERE customer_id = $1
+        RETURNING updated_at
     `
     
-    _, err := d.DB.Exec(query, 
+    err := d.DB.QueryRow(query, 
         customer.CustomerID, 
         customer.AccountID, 
         customer.ExpirationMinutes,
-    )
+        customer.MaxExpirationMinutes,
+        strings.Join(customer.Scopes, " "),
+        customer.RateLimitRequests,
+        rateLimitPeriodSeconds(customer),
+        customer.RateLimitBurst,
+    ).Scan(&customer.UpdatedAt)
+    if isUniqueViolation(err) { // account ID taken
+        return ErrCustomerExists
+    }
     
     return err
 }
 
+// RevokeAllCustomerTokens sets the customer's tokens_valid_after cutoff to
+// the current second, invalidating every token issued before it
+func (d *Database) RevokeAllCustomerTokens(customerID string) (time.Time, error) {
+    query := `
+        UPDATE customers
+        SET tokens_valid_after = ` + d.currentSecond() + `, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+        RETURNING tokens_valid_after
+    `
+
+    var validAfter time.Time
+    err := d.DB.QueryRow(query, customerID).Scan(&validAfter)
+
+    return validAfter, err
+}
+
+// DisableCustomer marks the customer disabled, sets its tokens_valid_after
+// cutoff to the current second and revokes its refresh tokens in one
+// transaction, so a failure cannot leave its tokens valid
+func (d *Database) DisableCustomer(customerID, reason string) (time.Time, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return time.Time{}, err
+    }
+    defer tx.Rollback()
+
+    query := `
+        UPDATE customers
+        SET status = $2, status_reason = $3, status_changed_at = CURRENT_TIMESTAMP,
+            tokens_valid_after = ` + d.currentSecond() + `, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+        RETURNING tokens_valid_after
+    `
+    var validAfter time.Time
+    if err := tx.QueryRow(query, customerID, models.CustomerStatusDisabled, reason).Scan(&validAfter); err != nil {
+        return time.Time{}, err
+    }
+
+    revokeQuery := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE customer_id = $1 AND revoked_at IS NULL`
+    if _, err := tx.Exec(revokeQuery, customerID); err != nil {
+        return time.Time{}, err
+    }
+
+    return validAfter, tx.Commit()
+}
+
+// DeleteCustomer removes the customer with its keys and users. Unknown
+// customers return sql.ErrNoRows.
 func (d *Database) DeleteCustomer(customerID string) error {
     query := `DELETE FROM customers WHERE customer_id = $1`
     
-    _, err := d.DB.Exec(query, customerID)
-    
-    return err
+    result, err := d.DB.Exec(query, customerID)
+    if err != nil {
+        return err
+    }
+
+    deleted, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if deleted == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// Ping checks that the database can be reached, giving up after
+// pingTimeout
+func (d *Database) Ping() error {
+    ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+    defer cancel()
+    return d.DB.PingContext(ctx)
 }
 
 func (d *Database) Close() {
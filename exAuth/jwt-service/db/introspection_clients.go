@@ -0,0 +1,73 @@
+package db
+
+import (
+    "database/sql"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+func (d *Database) CreateIntrospectionClient(client *models.IntrospectionClient) error {
+    query := `
+        INSERT INTO introspection_clients (client_id, client_secret_hash, name)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at
+    `
+
+    return d.DB.QueryRow(query, client.ClientID, client.ClientSecretHash, client.Name).Scan(&client.ID, &client.CreatedAt)
+}
+
+func (d *Database) GetIntrospectionClient(clientID string) (*models.IntrospectionClient, error) {
+    query := `SELECT id, client_id, client_secret_hash, name, created_at FROM introspection_clients WHERE client_id = $1`
+
+    client := &models.IntrospectionClient{}
+    err := d.DB.QueryRow(query, clientID).Scan(
+        &client.ID,
+        &client.ClientID,
+        &client.ClientSecretHash,
+        &client.Name,
+        &client.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    return client, nil
+}
+
+func (d *Database) ListIntrospectionClients() ([]*models.IntrospectionClient, error) {
+    query := `SELECT id, client_id, name, created_at FROM introspection_clients ORDER BY created_at DESC`
+
+    rows, err := d.DB.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var clients []*models.IntrospectionClient
+    for rows.Next() {
+        client := &models.IntrospectionClient{}
+        if err := rows.Scan(&client.ID, &client.ClientID, &client.Name, &client.CreatedAt); err != nil {
+            return nil, err
+        }
+        clients = append(clients, client)
+    }
+
+    return clients, rows.Err()
+}
+
+func (d *Database) DeleteIntrospectionClient(clientID string) error {
+    result, err := d.DB.Exec(`DELETE FROM introspection_clients WHERE client_id = $1`, clientID)
+    if err != nil {
+        return err
+    }
+
+    deleted, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if deleted == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
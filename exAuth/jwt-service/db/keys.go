@@ -0,0 +1,182 @@
+package db
+
+import (
+    "database/sql"
+    "time"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+const keyColumns = `id, customer_id, kid, version, secret_key, signing_algorithm, status, verify_until, created_at, retired_at`
+
+// A key can verify tokens while it is active or within its overlap window
+const verifiableKeyCondition = `(status = 'active' OR (status = 'verifying' AND verify_until > CURRENT_TIMESTAMP))`
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanCustomerKey scans a key and decrypts its secret
+func (d *Database) scanCustomerKey(row rowScanner) (*models.CustomerKey, error) {
+    key := &models.CustomerKey{}
+    var verifyUntil, retiredAt sql.NullTime
+
+    err := row.Scan(
+        &key.ID,
+        &key.CustomerID,
+        &key.KID,
+        &key.Version,
+        &key.SecretKey,
+        &key.SigningAlgorithm,
+        &key.Status,
+        &verifyUntil,
+        &key.CreatedAt,
+        &retiredAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    if key.SecretKey, err = d.decryptSecret(key.SecretKey, key.CustomerID); err != nil {
+        return nil, err
+    }
+    if verifyUntil.Valid {
+        key.VerifyUntil = &verifyUntil.Time
+    }
+    if retiredAt.Valid {
+        key.RetiredAt = &retiredAt.Time
+    }
+
+    return key, nil
+}
+
+func (d *Database) scanCustomerKeys(rows *sql.Rows) ([]*models.CustomerKey, error) {
+    defer rows.Close()
+
+    var keys []*models.CustomerKey
+    for rows.Next() {
+        key, err := d.scanCustomerKey(rows)
+        if err != nil {
+            return nil, err
+        }
+        keys = append(keys, key)
+    }
+
+    return keys, rows.Err()
+}
+
+// GetActiveKeyForCustomer returns the key new tokens are signed with
+func (d *Database) GetActiveKeyForCustomer(customerID string) (*models.CustomerKey, error) {
+    query := `SELECT ` + keyColumns + ` FROM customer_keys WHERE customer_id = $1 AND status = 'active'`
+
+    return d.scanCustomerKey(d.DB.QueryRow(query, customerID))
+}
+
+// GetVerificationKey returns the key with the given kid if it may still be
+// used to verify tokens. Retired and expired keys return sql.ErrNoRows.
+func (d *Database) GetVerificationKey(kid string) (*models.CustomerKey, error) {
+    query := `SELECT ` + keyColumns + ` FROM customer_keys WHERE kid = $1 AND ` + verifiableKeyCondition
+
+    return d.scanCustomerKey(d.DB.QueryRow(query, kid))
+}
+
+// ListVerificationKeys returns every key that may still verify tokens. An
+// empty customerID returns the keys of all customers.
+func (d *Database) ListVerificationKeys(customerID string) ([]*models.CustomerKey, error) {
+    query := `SELECT ` + keyColumns + ` FROM customer_keys
+        WHERE (CAST($1 AS TEXT) = '' OR customer_id = CAST($1 AS TEXT)) AND ` + verifiableKeyCondition + `
+        ORDER BY customer_id, version DESC`
+
+    rows, err := d.DB.Query(query, customerID)
+    if err != nil {
+        return nil, err
+    }
+
+    return d.scanCustomerKeys(rows)
+}
+
+// ListCustomerKeys returns all key versions of a customer, newest first
+func (d *Database) ListCustomerKeys(customerID string) ([]*models.CustomerKey, error) {
+    query := `SELECT ` + keyColumns + ` FROM customer_keys WHERE customer_id = $1 ORDER BY version DESC`
+
+    rows, err := d.DB.Query(query, customerID)
+    if err != nil {
+        return nil, err
+    }
+
+    return d.scanCustomerKeys(rows)
+}
+
+// RotateCustomerKey makes the given key material, identified by kid, the
+// customer's active key. The previous active key keeps verifying tokens for
+// the overlap window (or is retired immediately when overlap is zero), and
+// verifying keys whose window has passed are retired.
+func (d *Database) RotateCustomerKey(customerID, kid, secretKey, algorithm string, overlap time.Duration) (*models.CustomerKey, error) {
+    storedSecretKey, err := d.encryptSecret(secretKey, customerID)
+    if err != nil {
+        return nil, err
+    }
+
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Serialize concurrent rotations of the same customer
+    var id int64
+    if err := tx.QueryRow(`SELECT id FROM customers WHERE customer_id = $1`+d.forUpdate(), customerID).Scan(&id); err != nil {
+        return nil, err
+    }
+
+    retireExpiredQuery := `
+        UPDATE customer_keys SET status = 'retired', retired_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1 AND status = 'verifying' AND verify_until <= CURRENT_TIMESTAMP
+    `
+    if _, err := tx.Exec(retireExpiredQuery, customerID); err != nil {
+        return nil, err
+    }
+
+    if overlap > 0 {
+        demoteQuery := `
+            UPDATE customer_keys SET status = 'verifying', verify_until = CURRENT_TIMESTAMP + $2::integer * INTERVAL '1 second'
+            WHERE customer_id = $1 AND status = 'active'
+        `
+        if d.sqlite {
+            demoteQuery = `
+                UPDATE customer_keys SET status = 'verifying', verify_until = datetime(CURRENT_TIMESTAMP, '+' || $2 || ' seconds')
+                WHERE customer_id = $1 AND status = 'active'
+            `
+        }
+        if _, err := tx.Exec(demoteQuery, customerID, int64(overlap.Seconds())); err != nil {
+            return nil, err
+        }
+    } else {
+        retireQuery := `
+            UPDATE customer_keys SET status = 'retired', retired_at = CURRENT_TIMESTAMP
+            WHERE customer_id = $1 AND status = 'active'
+        `
+        if _, err := tx.Exec(retireQuery, customerID); err != nil {
+            return nil, err
+        }
+    }
+
+    insertQuery := `
+        INSERT INTO customer_keys (customer_id, kid, version, secret_key, signing_algorithm, status)
+        VALUES ($1, $2, (SELECT COALESCE(MAX(version), 0) + 1 FROM customer_keys WHERE customer_id = $1), $3, $4, 'active')
+        RETURNING ` + keyColumns
+    key, err := d.scanCustomerKey(tx.QueryRow(insertQuery, customerID, kid, storedSecretKey, algorithm))
+    if err != nil {
+        return nil, err
+    }
+
+    mirrorQuery := `
+        UPDATE customers SET secret_key = $2, signing_algorithm = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE customer_id = $1
+    `
+    if _, err := tx.Exec(mirrorQuery, customerID, storedSecretKey, algorithm); err != nil {
+        return nil, err
+    }
+
+    return key, tx.Commit()
+}
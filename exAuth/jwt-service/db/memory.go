@@ -0,0 +1,870 @@
+package db
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+// MemoryStore keeps everything in memory, for tests and single-binary demos.
+// Nothing survives a restart and replicas do not share it.
+type MemoryStore struct {
+    mu                   sync.Mutex
+    nextID               int64
+    customers            map[string]*models.Customer
+    keys                 []*models.CustomerKey
+    revokedTokens        map[string]time.Time
+    refreshTokens        map[string]*memoryRefreshToken
+    users                map[memoryUserKey]*models.User
+    routeScopes          []*models.RouteScope
+    introspectionClients map[string]*models.IntrospectionClient
+    buckets              map[string]models.RateLimitBucket
+    now                  func() time.Time
+}
+
+type memoryRefreshToken struct {
+    token   models.RefreshToken
+    used    bool
+    revoked bool
+}
+
+type memoryUserKey struct {
+    customerID string
+    userID     string
+}
+
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{
+        customers:            make(map[string]*models.Customer),
+        revokedTokens:        make(map[string]time.Time),
+        refreshTokens:        make(map[string]*memoryRefreshToken),
+        users:                make(map[memoryUserKey]*models.User),
+        introspectionClients: make(map[string]*models.IntrospectionClient),
+        buckets:              make(map[string]models.RateLimitBucket),
+        now:                  time.Now,
+    }
+}
+
+func (m *MemoryStore) id() int64 {
+    m.nextID++
+    return m.nextID
+}
+
+// copyCustomer returns a copy that callers can modify without changing the
+// stored customer
+func copyCustomer(customer *models.Customer) *models.Customer {
+    c := *customer
+    c.Scopes = append([]string(nil), customer.Scopes...)
+    if customer.StatusChangedAt != nil {
+        changedAt := *customer.StatusChangedAt
+        c.StatusChangedAt = &changedAt
+    }
+    if customer.TokensValidAfter != nil {
+        validAfter := *customer.TokensValidAfter
+        c.TokensValidAfter = &validAfter
+    }
+    return &c
+}
+
+func copyCustomerKey(key *models.CustomerKey) *models.CustomerKey {
+    k := *key
+    if key.VerifyUntil != nil {
+        verifyUntil := *key.VerifyUntil
+        k.VerifyUntil = &verifyUntil
+    }
+    if key.RetiredAt != nil {
+        retiredAt := *key.RetiredAt
+        k.RetiredAt = &retiredAt
+    }
+    return &k
+}
+
+// CreateCustomer inserts the customer together with its first (active) key,
+// identified by kid
+func (m *MemoryStore) CreateCustomer(customer *models.Customer, kid string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, existing := range m.customers {
+        if existing.CustomerID == customer.CustomerID || existing.AccountID == customer.AccountID ||
+            (customer.ClientID != "" && existing.ClientID == customer.ClientID) {
+            return ErrCustomerExists
+        }
+    }
+
+    now := m.now()
+    customer.ID = m.id()
+    customer.Status = models.CustomerStatusActive
+    customer.CreatedAt = now
+    customer.UpdatedAt = now
+
+    stored := copyCustomer(customer)
+    stored.RateLimitPeriodSeconds = rateLimitPeriodSeconds(customer)
+    stored.StatusReason = ""
+    stored.StatusChangedAt = nil
+    stored.TokensValidAfter = nil
+    m.customers[customer.CustomerID] = stored
+
+    m.keys = append(m.keys, &models.CustomerKey{
+        ID:               m.id(),
+        CustomerID:       customer.CustomerID,
+        KID:              kid,
+        Version:          1,
+        SecretKey:        customer.SecretKey,
+        SigningAlgorithm: customer.SigningAlgorithm,
+        Status:           models.KeyStatusActive,
+        CreatedAt:        now,
+    })
+
+    return nil
+}
+
+func (m *MemoryStore) GetCustomerByID(customerID string) (*models.Customer, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    return copyCustomer(customer), nil
+}
+
+// GetCustomerByClientID looks up a customer by its OAuth2 client ID
+func (m *MemoryStore) GetCustomerByClientID(clientID string) (*models.Customer, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, customer := range m.customers {
+        if clientID != "" && customer.ClientID == clientID {
+            return copyCustomer(customer), nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+// GetSecretKeyForCustomer returns the customer's key material and the
+// algorithm it is used with
+func (m *MemoryStore) GetSecretKeyForCustomer(customerID string) (string, string, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return "", "", sql.ErrNoRows
+    }
+    return customer.SecretKey, customer.SigningAlgorithm, nil
+}
+
+// sortedCustomers returns copies of all customers, newest first
+func (m *MemoryStore) sortedCustomers() []*models.Customer {
+    var customers []*models.Customer
+    for _, customer := range m.customers {
+        customers = append(customers, copyCustomer(customer))
+    }
+    sort.Slice(customers, func(i, j int) bool {
+        if !customers[i].CreatedAt.Equal(customers[j].CreatedAt) {
+            return customers[i].CreatedAt.After(customers[j].CreatedAt)
+        }
+        return customers[i].ID > customers[j].ID
+    })
+    return customers
+}
+
+func (m *MemoryStore) ListCustomers() ([]*models.Customer, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    return m.sortedCustomers(), nil
+}
+
+// ListCustomersPage returns up to limit customers, newest first, skipping
+// the first offset
+func (m *MemoryStore) ListCustomersPage(limit, offset int) ([]*models.Customer, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customers := m.sortedCustomers()
+    if offset >= len(customers) {
+        return nil, nil
+    }
+    customers = customers[offset:]
+    if limit < len(customers) {
+        customers = customers[:limit]
+    }
+    return customers, nil
+}
+
+// UpdateCustomer stores the customer's settings. Unknown customers return
+// sql.ErrNoRows.
+func (m *MemoryStore) UpdateCustomer(customer *models.Customer) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    stored, ok := m.customers[customer.CustomerID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    for _, existing := range m.customers {
+        if existing != stored && existing.AccountID == customer.AccountID {
+            return ErrCustomerExists
+        }
+    }
+
+    stored.AccountID = customer.AccountID
+    stored.ExpirationMinutes = customer.ExpirationMinutes
+    stored.MaxExpirationMinutes = customer.MaxExpirationMinutes
+    stored.Scopes = append([]string(nil), customer.Scopes...)
+    stored.RateLimitRequests = customer.RateLimitRequests
+    stored.RateLimitPeriodSeconds = rateLimitPeriodSeconds(customer)
+    stored.RateLimitBurst = customer.RateLimitBurst
+    stored.UpdatedAt = m.now()
+    customer.UpdatedAt = stored.UpdatedAt
+
+    return nil
+}
+
+// updateCustomer applies update to a stored customer. Unknown customers
+// return sql.ErrNoRows.
+func (m *MemoryStore) updateCustomer(customerID string, update func(customer *models.Customer)) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    update(customer)
+    customer.UpdatedAt = m.now()
+    return nil
+}
+
+// SetClientCredentials replaces the customer's client ID and secret hash
+func (m *MemoryStore) SetClientCredentials(customerID, clientID, clientSecretHash string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return sql.ErrNoRows
+    }
+    for _, existing := range m.customers {
+        if existing != customer && existing.ClientID == clientID {
+            return fmt.Errorf("client ID %s is already in use", clientID)
+        }
+    }
+
+    customer.ClientID = clientID
+    customer.ClientSecretHash = clientSecretHash
+    customer.UpdatedAt = m.now()
+    return nil
+}
+
+// SetCustomerScopes replaces the scopes the customer's tokens may be granted
+func (m *MemoryStore) SetCustomerScopes(customerID string, scopes []string) error {
+    return m.updateCustomer(customerID, func(customer *models.Customer) {
+        customer.Scopes = append([]string(nil), scopes...)
+    })
+}
+
+// SetCustomerRateLimit replaces the customer's request quota. 0 requests
+// removes the limit.
+func (m *MemoryStore) SetCustomerRateLimit(customerID string, requests, periodSeconds, burst int) error {
+    return m.updateCustomer(customerID, func(customer *models.Customer) {
+        customer.RateLimitRequests = requests
+        customer.RateLimitPeriodSeconds = periodSeconds
+        customer.RateLimitBurst = burst
+    })
+}
+
+// SetCustomerStatus changes whether the customer can mint and use tokens and
+// records why and when
+func (m *MemoryStore) SetCustomerStatus(customerID, status, reason string) error {
+    return m.updateCustomer(customerID, func(customer *models.Customer) {
+        changedAt := m.now()
+        customer.Status = status
+        customer.StatusReason = reason
+        customer.StatusChangedAt = &changedAt
+    })
+}
+
+// RevokeAllCustomerTokens sets the customer's tokens_valid_after cutoff to
+// the current second, invalidating every token issued before it
+func (m *MemoryStore) RevokeAllCustomerTokens(customerID string) (time.Time, error) {
+    var validAfter time.Time
+    err := m.updateCustomer(customerID, func(customer *models.Customer) {
+        validAfter = m.now().Truncate(time.Second)
+        customer.TokensValidAfter = &validAfter
+    })
+
+    return validAfter, err
+}
+
+// DisableCustomer marks the customer disabled, sets its tokens_valid_after
+// cutoff to the current second and revokes its refresh tokens at once
+func (m *MemoryStore) DisableCustomer(customerID, reason string) (time.Time, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return time.Time{}, sql.ErrNoRows
+    }
+    now := m.now()
+    validAfter := now.Truncate(time.Second)
+    customer.Status = models.CustomerStatusDisabled
+    customer.StatusReason = reason
+    customer.StatusChangedAt = &now
+    customer.TokensValidAfter = &validAfter
+    customer.UpdatedAt = now
+
+    for _, refreshToken := range m.refreshTokens {
+        if refreshToken.token.CustomerID == customerID {
+            refreshToken.revoked = true
+        }
+    }
+    return validAfter, nil
+}
+
+// DeleteCustomer removes the customer with its keys, users and refresh
+// tokens. Unknown customers return sql.ErrNoRows.
+func (m *MemoryStore) DeleteCustomer(customerID string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.customers[customerID]; !ok {
+        return sql.ErrNoRows
+    }
+    delete(m.customers, customerID)
+
+    keys := m.keys[:0]
+    for _, key := range m.keys {
+        if key.CustomerID != customerID {
+            keys = append(keys, key)
+        }
+    }
+    m.keys = keys
+
+    for userKey := range m.users {
+        if userKey.customerID == customerID {
+            delete(m.users, userKey)
+        }
+    }
+    for hash, refreshToken := range m.refreshTokens {
+        if refreshToken.token.CustomerID == customerID {
+            delete(m.refreshTokens, hash)
+        }
+    }
+
+    return nil
+}
+
+// verifiable reports whether a key can verify tokens at now, like
+// verifiableKeyCondition
+func verifiable(key *models.CustomerKey, now time.Time) bool {
+    return key.Status == models.KeyStatusActive ||
+        (key.Status == models.KeyStatusVerifying && key.VerifyUntil != nil && key.VerifyUntil.After(now))
+}
+
+// sortKeys orders keys by customer and newest version first
+func sortKeys(keys []*models.CustomerKey) {
+    sort.Slice(keys, func(i, j int) bool {
+        if keys[i].CustomerID != keys[j].CustomerID {
+            return keys[i].CustomerID < keys[j].CustomerID
+        }
+        return keys[i].Version > keys[j].Version
+    })
+}
+
+// GetActiveKeyForCustomer returns the key new tokens are signed with
+func (m *MemoryStore) GetActiveKeyForCustomer(customerID string) (*models.CustomerKey, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, key := range m.keys {
+        if key.CustomerID == customerID && key.Status == models.KeyStatusActive {
+            return copyCustomerKey(key), nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+// GetVerificationKey returns the key with the given kid if it may still be
+// used to verify tokens. Retired and expired keys return sql.ErrNoRows.
+func (m *MemoryStore) GetVerificationKey(kid string) (*models.CustomerKey, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    for _, key := range m.keys {
+        if key.KID == kid && verifiable(key, now) {
+            return copyCustomerKey(key), nil
+        }
+    }
+    return nil, sql.ErrNoRows
+}
+
+// ListVerificationKeys returns every key that may still verify tokens. An
+// empty customerID returns the keys of all customers.
+func (m *MemoryStore) ListVerificationKeys(customerID string) ([]*models.CustomerKey, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    var keys []*models.CustomerKey
+    for _, key := range m.keys {
+        if (customerID == "" || key.CustomerID == customerID) && verifiable(key, now) {
+            keys = append(keys, copyCustomerKey(key))
+        }
+    }
+    sortKeys(keys)
+    return keys, nil
+}
+
+// ListCustomerKeys returns all key versions of a customer, newest first
+func (m *MemoryStore) ListCustomerKeys(customerID string) ([]*models.CustomerKey, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var keys []*models.CustomerKey
+    for _, key := range m.keys {
+        if key.CustomerID == customerID {
+            keys = append(keys, copyCustomerKey(key))
+        }
+    }
+    sortKeys(keys)
+    return keys, nil
+}
+
+// RotateCustomerKey makes the given key material, identified by kid, the
+// customer's active key. The previous active key keeps verifying tokens for
+// the overlap window (or is retired immediately when overlap is zero), and
+// verifying keys whose window has passed are retired.
+func (m *MemoryStore) RotateCustomerKey(customerID, kid, secretKey, algorithm string, overlap time.Duration) (*models.CustomerKey, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    customer, ok := m.customers[customerID]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+
+    now := m.now()
+    version := 0
+    for _, key := range m.keys {
+        if key.CustomerID != customerID {
+            continue
+        }
+        version = max(version, key.Version)
+
+        retire := (key.Status == models.KeyStatusVerifying && !verifiable(key, now)) ||
+            (key.Status == models.KeyStatusActive && overlap <= 0)
+        switch {
+        case retire:
+            retiredAt := now
+            key.Status = models.KeyStatusRetired
+            key.RetiredAt = &retiredAt
+        case key.Status == models.KeyStatusActive:
+            verifyUntil := now.Add(overlap.Truncate(time.Second))
+            key.Status = models.KeyStatusVerifying
+            key.VerifyUntil = &verifyUntil
+        }
+    }
+
+    key := &models.CustomerKey{
+        ID:               m.id(),
+        CustomerID:       customerID,
+        KID:              kid,
+        Version:          version + 1,
+        SecretKey:        secretKey,
+        SigningAlgorithm: algorithm,
+        Status:           models.KeyStatusActive,
+        CreatedAt:        now,
+    }
+    m.keys = append(m.keys, key)
+
+    customer.SecretKey = secretKey
+    customer.SigningAlgorithm = algorithm
+    customer.UpdatedAt = now
+
+    return copyCustomerKey(key), nil
+}
+
+// RevokeToken adds a token ID to the denylist. Revoking an already revoked
+// token is a no-op.
+func (m *MemoryStore) RevokeToken(jti, customerID, reason string, expiresAt time.Time) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.revokedTokens[jti]; !ok {
+        m.revokedTokens[jti] = expiresAt
+    }
+    return nil
+}
+
+// ListRevokedTokens returns the IDs and expiry of every revoked token that
+// has not expired yet
+func (m *MemoryStore) ListRevokedTokens() (map[string]time.Time, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    revoked := make(map[string]time.Time)
+    for jti, expiresAt := range m.revokedTokens {
+        if expiresAt.After(now) {
+            revoked[jti] = expiresAt
+        }
+    }
+    return revoked, nil
+}
+
+// PurgeExpiredRevokedTokens deletes denylist entries for tokens that have
+// expired and returns how many were removed
+func (m *MemoryStore) PurgeExpiredRevokedTokens() (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    var purged int64
+    for jti, expiresAt := range m.revokedTokens {
+        if !expiresAt.After(now) {
+            delete(m.revokedTokens, jti)
+            purged++
+        }
+    }
+    return purged, nil
+}
+
+// CreateRefreshToken stores the hash of a new refresh token
+func (m *MemoryStore) CreateRefreshToken(tokenHash string, token *models.RefreshToken) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.customers[token.CustomerID]; !ok {
+        return fmt.Errorf("unknown customer %s", token.CustomerID)
+    }
+    if _, ok := m.refreshTokens[tokenHash]; ok {
+        return fmt.Errorf("refresh token already exists")
+    }
+
+    stored := *token
+    stored.Scopes = append([]string(nil), token.Scopes...)
+    stored.Audience = append([]string(nil), token.Audience...)
+    m.refreshTokens[tokenHash] = &memoryRefreshToken{token: stored}
+    return nil
+}
+
+// GetRefreshToken returns a refresh token without exchanging it. Unknown,
+// expired and revoked tokens return sql.ErrNoRows; a token that was already
+// used returns ErrRefreshTokenReused along with the token.
+func (m *MemoryStore) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    stored, ok := m.refreshTokens[tokenHash]
+    if !ok || stored.revoked {
+        return nil, sql.ErrNoRows
+    }
+
+    token := stored.token
+    token.Scopes = append([]string(nil), stored.token.Scopes...)
+    token.Audience = append([]string(nil), stored.token.Audience...)
+
+    if stored.used {
+        return &token, ErrRefreshTokenReused
+    }
+    if !token.ExpiresAt.After(m.now()) {
+        return nil, sql.ErrNoRows
+    }
+
+    return &token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// family and returns the new token. Unknown, expired and revoked tokens return
+// sql.ErrNoRows; a token that was already used revokes its family and returns
+// ErrRefreshTokenReused along with the token.
+func (m *MemoryStore) RotateRefreshToken(tokenHash, newTokenHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    stored, ok := m.refreshTokens[tokenHash]
+    if !ok || stored.revoked {
+        return nil, sql.ErrNoRows
+    }
+
+    token := stored.token
+    token.Scopes = append([]string(nil), stored.token.Scopes...)
+    token.Audience = append([]string(nil), stored.token.Audience...)
+
+    if stored.used {
+        for _, refreshToken := range m.refreshTokens {
+            if refreshToken.token.FamilyID == token.FamilyID {
+                refreshToken.revoked = true
+            }
+        }
+        return &token, ErrRefreshTokenReused
+    }
+
+    if !token.ExpiresAt.After(m.now()) {
+        return nil, sql.ErrNoRows
+    }
+    if _, ok := m.refreshTokens[newTokenHash]; ok {
+        return nil, fmt.Errorf("refresh token already exists")
+    }
+
+    stored.used = true
+    token.ExpiresAt = expiresAt
+    next := token
+    next.Scopes = append([]string(nil), token.Scopes...)
+    next.Audience = append([]string(nil), token.Audience...)
+    m.refreshTokens[newTokenHash] = &memoryRefreshToken{token: next}
+
+    return &token, nil
+}
+
+// RevokeCustomerRefreshTokens revokes every outstanding refresh token of a
+// customer
+func (m *MemoryStore) RevokeCustomerRefreshTokens(customerID string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, refreshToken := range m.refreshTokens {
+        if refreshToken.token.CustomerID == customerID {
+            refreshToken.revoked = true
+        }
+    }
+    return nil
+}
+
+// PurgeExpiredRefreshTokens deletes refresh tokens that can no longer be
+// exchanged and returns how many were removed
+func (m *MemoryStore) PurgeExpiredRefreshTokens() (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    var purged int64
+    for hash, refreshToken := range m.refreshTokens {
+        if !refreshToken.token.ExpiresAt.After(now) {
+            delete(m.refreshTokens, hash)
+            purged++
+        }
+    }
+    return purged, nil
+}
+
+func (m *MemoryStore) CreateUser(user *models.User) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.customers[user.CustomerID]; !ok {
+        return fmt.Errorf("unknown customer %s", user.CustomerID)
+    }
+    key := memoryUserKey{user.CustomerID, user.UserID}
+    if _, ok := m.users[key]; ok {
+        return fmt.Errorf("user %s already exists", user.UserID)
+    }
+
+    user.ID = m.id()
+    user.CreatedAt = m.now()
+    stored := *user
+    m.users[key] = &stored
+    return nil
+}
+
+// GetUser returns sql.ErrNoRows if the user does not belong to the customer
+func (m *MemoryStore) GetUser(customerID, userID string) (*models.User, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    user, ok := m.users[memoryUserKey{customerID, userID}]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    u := *user
+    return &u, nil
+}
+
+func (m *MemoryStore) ListUsers(customerID string) ([]*models.User, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var users []*models.User
+    for key, user := range m.users {
+        if key.customerID == customerID {
+            u := *user
+            users = append(users, &u)
+        }
+    }
+    sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+    return users, nil
+}
+
+func (m *MemoryStore) DeleteUser(customerID, userID string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    key := memoryUserKey{customerID, userID}
+    if _, ok := m.users[key]; !ok {
+        return sql.ErrNoRows
+    }
+    delete(m.users, key)
+    return nil
+}
+
+func (m *MemoryStore) CreateRouteScope(route *models.RouteScope) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for _, existing := range m.routeScopes {
+        if existing.Host == route.Host && existing.PathPrefix == route.PathPrefix && existing.Method == route.Method {
+            return fmt.Errorf("route scope for %s %s%s already exists", route.Method, route.Host, route.PathPrefix)
+        }
+    }
+
+    route.ID = m.id()
+    route.CreatedAt = m.now()
+    stored := *route
+    m.routeScopes = append(m.routeScopes, &stored)
+    return nil
+}
+
+func (m *MemoryStore) ListRouteScopes() ([]*models.RouteScope, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var routes []*models.RouteScope
+    for _, route := range m.routeScopes {
+        r := *route
+        routes = append(routes, &r)
+    }
+    sort.Slice(routes, func(i, j int) bool {
+        a, b := routes[i], routes[j]
+        if a.Host != b.Host {
+            return a.Host < b.Host
+        }
+        if a.PathPrefix != b.PathPrefix {
+            return a.PathPrefix < b.PathPrefix
+        }
+        return a.Method < b.Method
+    })
+    return routes, nil
+}
+
+func (m *MemoryStore) DeleteRouteScope(id int64) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    for i, route := range m.routeScopes {
+        if route.ID == id {
+            m.routeScopes = append(m.routeScopes[:i], m.routeScopes[i+1:]...)
+            return nil
+        }
+    }
+    return sql.ErrNoRows
+}
+
+func (m *MemoryStore) CreateIntrospectionClient(client *models.IntrospectionClient) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.introspectionClients[client.ClientID]; ok {
+        return fmt.Errorf("introspection client %s already exists", client.ClientID)
+    }
+
+    client.ID = m.id()
+    client.CreatedAt = m.now()
+    stored := *client
+    m.introspectionClients[client.ClientID] = &stored
+    return nil
+}
+
+func (m *MemoryStore) GetIntrospectionClient(clientID string) (*models.IntrospectionClient, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    client, ok := m.introspectionClients[clientID]
+    if !ok {
+        return nil, sql.ErrNoRows
+    }
+    c := *client
+    return &c, nil
+}
+
+// ListIntrospectionClients leaves out the secret hashes, like the Postgres
+// query
+func (m *MemoryStore) ListIntrospectionClients() ([]*models.IntrospectionClient, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    var clients []*models.IntrospectionClient
+    for _, client := range m.introspectionClients {
+        c := *client
+        c.ClientSecretHash = ""
+        clients = append(clients, &c)
+    }
+    sort.Slice(clients, func(i, j int) bool {
+        if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+            return clients[i].CreatedAt.After(clients[j].CreatedAt)
+        }
+        return clients[i].ID > clients[j].ID
+    })
+    return clients, nil
+}
+
+func (m *MemoryStore) DeleteIntrospectionClient(clientID string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    if _, ok := m.introspectionClients[clientID]; !ok {
+        return sql.ErrNoRows
+    }
+    delete(m.introspectionClients, clientID)
+    return nil
+}
+
+// UpdateRateLimitBucket passes the bucket to update and stores the result.
+// Missing buckets start with capacity tokens.
+func (m *MemoryStore) UpdateRateLimitBucket(key string, capacity float64, update func(bucket *models.RateLimitBucket, now time.Time)) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    now := m.now()
+    bucket, ok := m.buckets[key]
+    if !ok {
+        bucket = models.RateLimitBucket{Key: key, Tokens: capacity, UpdatedAt: now}
+    }
+
+    update(&bucket, now)
+    m.buckets[key] = bucket
+    return nil
+}
+
+// PurgeIdleRateLimitBuckets deletes buckets that have not been used for the
+// given duration and returns how many were removed
+func (m *MemoryStore) PurgeIdleRateLimitBuckets(idle time.Duration) (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    cutoff := m.now().Add(-idle)
+    var purged int64
+    for key, bucket := range m.buckets {
+        if bucket.UpdatedAt.Before(cutoff) {
+            delete(m.buckets, key)
+            purged++
+        }
+    }
+    return purged, nil
+}
+
+// Ping always succeeds, the store lives in this process
+func (m *MemoryStore) Ping() error {
+    return nil
+}
+
+func (m *MemoryStore) Close() {}
@@ -0,0 +1,139 @@
+package db
+
+import (
+    "database/sql"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/vishalk17/jwt-service/models"
+)
+
+func TestMemoryStoreCustomers(t *testing.T) {
+    store := NewMemoryStore()
+
+    customer := &models.Customer{CustomerID: "acme", AccountID: "acme-account", SecretKey: "secret", SigningAlgorithm: "HS256"}
+    assert.NoError(t, store.CreateCustomer(customer, "kid-1"))
+    assert.Equal(t, models.CustomerStatusActive, customer.Status)
+    assert.Equal(t, ErrCustomerExists, store.CreateCustomer(&models.Customer{CustomerID: "globex", AccountID: "acme-account"}, "kid-2"))
+
+    _, err := store.GetCustomerByID("globex")
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+    // Callers get copies
+    stored, err := store.GetCustomerByID("acme")
+    assert.NoError(t, err)
+    stored.AccountID = "changed"
+    stored, _ = store.GetCustomerByID("acme")
+    assert.Equal(t, "acme-account", stored.AccountID)
+
+    assert.NoError(t, store.SetCustomerStatus("acme", models.CustomerStatusSuspended, "unpaid invoice"))
+    stored, _ = store.GetCustomerByID("acme")
+    assert.Equal(t, models.CustomerStatusSuspended, stored.Status)
+    assert.Equal(t, "unpaid invoice", stored.StatusReason)
+    assert.NotNil(t, stored.StatusChangedAt)
+    assert.True(t, errors.Is(store.SetCustomerStatus("globex", models.CustomerStatusActive, ""), sql.ErrNoRows))
+
+    assert.NoError(t, store.CreateUser(&models.User{CustomerID: "acme", UserID: "alice"}))
+    assert.NoError(t, store.DeleteCustomer("acme"))
+    _, err = store.GetUser("acme", "alice")
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+    keys, _ := store.ListCustomerKeys("acme")
+    assert.Empty(t, keys)
+    assert.True(t, errors.Is(store.DeleteCustomer("acme"), sql.ErrNoRows))
+}
+
+func TestMemoryStoreRotateCustomerKey(t *testing.T) {
+    store := NewMemoryStore()
+    now := time.Now()
+    store.now = func() time.Time { return now }
+
+    assert.NoError(t, store.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", SecretKey: "v1", SigningAlgorithm: "HS256"}, "kid-1"))
+    first, err := store.GetActiveKeyForCustomer("acme")
+    assert.NoError(t, err)
+
+    second, err := store.RotateCustomerKey("acme", "kid-2", "v2", "HS256", time.Hour)
+    assert.NoError(t, err)
+    assert.Equal(t, 2, second.Version)
+
+    // The previous key verifies until the overlap ends
+    key, err := store.GetVerificationKey(first.KID)
+    assert.NoError(t, err)
+    assert.Equal(t, models.KeyStatusVerifying, key.Status)
+    keys, _ := store.ListVerificationKeys("")
+    assert.Len(t, keys, 2)
+
+    now = now.Add(2 * time.Hour)
+    _, err = store.GetVerificationKey(first.KID)
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+    // Rotating retires expired keys and, without overlap, the active one
+    _, err = store.RotateCustomerKey("acme", "kid-3", "v3", "ES256", 0)
+    assert.NoError(t, err)
+    keys, _ = store.ListCustomerKeys("acme")
+    assert.Equal(t, []string{models.KeyStatusActive, models.KeyStatusRetired, models.KeyStatusRetired},
+        []string{keys[0].Status, keys[1].Status, keys[2].Status})
+
+    secretKey, algorithm, err := store.GetSecretKeyForCustomer("acme")
+    assert.NoError(t, err)
+    assert.Equal(t, "v3", secretKey)
+    assert.Equal(t, "ES256", algorithm)
+}
+
+func TestMemoryStoreRefreshTokenReuse(t *testing.T) {
+    store := NewMemoryStore()
+    assert.NoError(t, store.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account"}, "kid-1"))
+
+    expiresAt := time.Now().Add(time.Hour)
+    assert.NoError(t, store.CreateRefreshToken("first", &models.RefreshToken{FamilyID: "family", CustomerID: "acme", Scopes: []string{"read"}, ExpiresAt: expiresAt}))
+
+    // Looking a token up does not consume it
+    token, err := store.GetRefreshToken("first")
+    assert.NoError(t, err)
+    assert.Equal(t, "acme", token.CustomerID)
+
+    token, err = store.RotateRefreshToken("first", "second", expiresAt)
+    assert.NoError(t, err)
+    assert.Equal(t, []string{"read"}, token.Scopes)
+    _, err = store.GetRefreshToken("first")
+    assert.Equal(t, ErrRefreshTokenReused, err)
+
+    // Replaying the first token revokes the whole family
+    _, err = store.RotateRefreshToken("first", "third", expiresAt)
+    assert.Equal(t, ErrRefreshTokenReused, err)
+    _, err = store.RotateRefreshToken("second", "fourth", expiresAt)
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+    _, err = store.RotateRefreshToken("unknown", "fifth", expiresAt)
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestMemoryStoreDisableCustomer(t *testing.T) {
+    store := NewMemoryStore()
+    now := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+    store.now = func() time.Time { return now }
+    assert.NoError(t, store.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account"}, "kid-1"))
+    assert.NoError(t, store.CreateRefreshToken("refresh", &models.RefreshToken{FamilyID: "family", CustomerID: "acme", ExpiresAt: now.Add(time.Hour)}))
+
+    validAfter, err := store.DisableCustomer("acme", "offboarded")
+    assert.NoError(t, err)
+    assert.Equal(t, now.Truncate(time.Second), validAfter)
+
+    // Status, cutoff and refresh tokens change together
+    stored, _ := store.GetCustomerByID("acme")
+    assert.Equal(t, models.CustomerStatusDisabled, stored.Status)
+    assert.Equal(t, "offboarded", stored.StatusReason)
+    assert.Equal(t, validAfter, *stored.TokensValidAfter)
+    _, err = store.GetRefreshToken("refresh")
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+    _, err = store.DisableCustomer("globex", "")
+    assert.True(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestOpenMemoryStore(t *testing.T) {
+    store, err := Open("memory:", nil)
+    assert.NoError(t, err)
+    assert.IsType(t, &MemoryStore{}, store)
+}
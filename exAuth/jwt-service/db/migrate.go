@@ -0,0 +1,310 @@
+package db
+
+import (
+    "context"
+    "database/sql"
+    "embed"
+    "errors"
+    "fmt"
+    "io/fs"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Migrations are numbered NNNN_name.up.sql / NNNN_name.down.sql files, one
+// directory per dialect. Never edit a released migration; add a new one.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database has migrations applied that
+// this binary does not know about, i.e. it was migrated by a newer release
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// migrationLockID is the Postgres advisory lock held while migrating, so
+// that replicas starting at the same time apply each migration once
+const migrationLockID = 7_262_519_038
+
+const createSchemaMigrationsTableQuery = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    )
+`
+
+// Migration is one numbered schema change and how to revert it
+type Migration struct {
+    Version int
+    Name    string
+    Up      string
+    Down    string
+}
+
+// MigrationStatus is a migration known to this binary or applied to the
+// database. Unknown migrations were applied by a newer release.
+type MigrationStatus struct {
+    Version   int
+    Name      string
+    AppliedAt *time.Time
+    Known     bool
+}
+
+// Migrations returns the migrations of the dialect in order
+func Migrations(sqlite bool) ([]Migration, error) {
+    dir := "migrations/postgres"
+    if sqlite {
+        dir = "migrations/sqlite"
+    }
+
+    entries, err := fs.ReadDir(migrationFiles, dir)
+    if err != nil {
+        return nil, err
+    }
+
+    byVersion := make(map[int]*Migration)
+    for _, entry := range entries {
+        name := entry.Name()
+        base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+        versionText, migrationName, found := strings.Cut(base, "_")
+        version, err := strconv.Atoi(versionText)
+        if !ok || !found || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+            return nil, fmt.Errorf("invalid migration file name %s", name)
+        }
+
+        data, err := fs.ReadFile(migrationFiles, dir+"/"+name)
+        if err != nil {
+            return nil, err
+        }
+
+        migration, ok := byVersion[version]
+        if !ok {
+            migration = &Migration{Version: version, Name: migrationName}
+            byVersion[version] = migration
+        }
+        if migration.Name != migrationName {
+            return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, migrationName)
+        }
+        if direction == "up" {
+            migration.Up = string(data)
+        } else {
+            migration.Down = string(data)
+        }
+    }
+
+    var migrations []Migration
+    for _, migration := range byVersion {
+        if migration.Up == "" {
+            return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+        }
+        migrations = append(migrations, *migration)
+    }
+    sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+    return migrations, nil
+}
+
+// withMigrationLock runs fn on a single connection. On Postgres the
+// connection holds the migration advisory lock; SQLite only has one
+// connection to begin with.
+func (d *Database) withMigrationLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+    ctx := context.Background()
+    conn, err := d.DB.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    if !d.sqlite {
+        if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+            return fmt.Errorf("failed to acquire migration lock: %w", err)
+        }
+        defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+    }
+
+    if _, err := conn.ExecContext(ctx, createSchemaMigrationsTableQuery); err != nil {
+        return err
+    }
+
+    return fn(ctx, conn)
+}
+
+// appliedMigrations returns when each applied migration was applied, by
+// version
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+    rows, err := conn.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    applied := make(map[int]appliedMigration)
+    for rows.Next() {
+        var migration appliedMigration
+        if err := rows.Scan(&migration.version, &migration.name, &migration.appliedAt); err != nil {
+            return nil, err
+        }
+        applied[migration.version] = migration
+    }
+
+    return applied, rows.Err()
+}
+
+type appliedMigration struct {
+    version   int
+    name      string
+    appliedAt time.Time
+}
+
+// checkSchemaVersion fails with ErrSchemaTooNew when a migration this binary
+// does not know has been applied
+func checkSchemaVersion(migrations []Migration, applied map[int]appliedMigration) error {
+    known := make(map[int]bool, len(migrations))
+    for _, migration := range migrations {
+        known[migration.Version] = true
+    }
+    for version, migration := range applied {
+        if !known[version] {
+            return fmt.Errorf("%w: migration %d_%s is unknown", ErrSchemaTooNew, version, migration.name)
+        }
+    }
+    return nil
+}
+
+// runMigration applies the SQL and records the result in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, script); err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// MigrateUp applies every pending migration in order and returns the ones it
+// applied. It fails with ErrSchemaTooNew without changing anything when the
+// database was migrated by a newer release.
+func (d *Database) MigrateUp() ([]Migration, error) {
+    migrations, err := Migrations(d.sqlite)
+    if err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    err = d.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        if err := checkSchemaVersion(migrations, applied); err != nil {
+            return err
+        }
+
+        for _, migration := range migrations {
+            if _, ok := applied[migration.Version]; ok {
+                continue
+            }
+            record := `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+            if err := runMigration(ctx, conn, migration.Up, record, migration.Version, migration.Name); err != nil {
+                return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+            }
+            done = append(done, migration)
+        }
+        return nil
+    })
+
+    return done, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns the ones it reverted
+func (d *Database) MigrateDown(steps int) ([]Migration, error) {
+    migrations, err := Migrations(d.sqlite)
+    if err != nil {
+        return nil, err
+    }
+
+    var done []Migration
+    err = d.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+        if err := checkSchemaVersion(migrations, applied); err != nil {
+            return err
+        }
+
+        for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+            migration := migrations[i]
+            if _, ok := applied[migration.Version]; !ok {
+                continue
+            }
+            if migration.Down == "" {
+                return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+            }
+            record := `DELETE FROM schema_migrations WHERE version = $1`
+            if err := runMigration(ctx, conn, migration.Down, record, migration.Version); err != nil {
+                return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+            }
+            done = append(done, migration)
+        }
+        return nil
+    })
+
+    return done, err
+}
+
+// MigrationStatus lists the known and applied migrations in order
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+    migrations, err := Migrations(d.sqlite)
+    if err != nil {
+        return nil, err
+    }
+
+    var statuses []MigrationStatus
+    err = d.withMigrationLock(func(ctx context.Context, conn *sql.Conn) error {
+        applied, err := appliedMigrations(ctx, conn)
+        if err != nil {
+            return err
+        }
+
+        for _, migration := range migrations {
+            status := MigrationStatus{Version: migration.Version, Name: migration.Name, Known: true}
+            if a, ok := applied[migration.Version]; ok {
+                status.AppliedAt = &a.appliedAt
+                delete(applied, migration.Version)
+            }
+            statuses = append(statuses, status)
+        }
+        for _, a := range applied {
+            appliedAt := a.appliedAt
+            statuses = append(statuses, MigrationStatus{Version: a.version, Name: a.name, AppliedAt: &appliedAt})
+        }
+        return nil
+    })
+    sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+    return statuses, err
+}
+
+// ConnectDatabase connects to Postgres, or SQLite for "sqlite:<path>" URLs,
+// without applying migrations
+func ConnectDatabase(url string) (*Database, error) {
+    if url == "memory:" || url == "memory://" {
+        return nil, errors.New("the in-memory store has no schema")
+    }
+    if path, ok := sqlitePath(url); ok {
+        return connectSQLite(path)
+    }
+    return connectPostgres(url)
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+    postgres, err := Migrations(false)
+    assert.NoError(t, err)
+    sqlite, err := Migrations(true)
+    assert.NoError(t, err)
+
+    // Both dialects have the same ordered, gapless set
+    assert.Equal(t, len(postgres), len(sqlite))
+    for i, migration := range postgres {
+        assert.Equal(t, i+1, migration.Version)
+        assert.Equal(t, migration.Name, sqlite[i].Name)
+        assert.NotEmpty(t, migration.Up)
+        assert.NotEmpty(t, migration.Down)
+        assert.NotEmpty(t, sqlite[i].Up)
+        assert.NotEmpty(t, sqlite[i].Down)
+    }
+    assert.Equal(t, "customers", postgres[0].Name)
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+    migrations := []Migration{{Version: 1, Name: "customers"}, {Version: 2, Name: "customer_keys"}}
+
+    assert.NoError(t, checkSchemaVersion(migrations, nil))
+    assert.NoError(t, checkSchemaVersion(migrations, map[int]appliedMigration{1: {version: 1, name: "customers", appliedAt: time.Now()}}))
+
+    err := checkSchemaVersion(migrations, map[int]appliedMigration{3: {version: 3, name: "from_the_future", appliedAt: time.Now()}})
+    assert.True(t, errors.Is(err, ErrSchemaTooNew))
+    assert.Contains(t, err.Error(), "from_the_future")
+}
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS customers (
+    id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(255) UNIQUE NOT NULL,
+    account_id VARCHAR(255) UNIQUE NOT NULL,
+    secret_key TEXT NOT NULL,
+    signing_algorithm VARCHAR(16) NOT NULL DEFAULT 'HS256',
+    client_id VARCHAR(64) UNIQUE,
+    client_secret_hash CHAR(64),
+    expiration_minutes INTEGER DEFAULT 60,
+    max_expiration_minutes INTEGER NOT NULL DEFAULT 0,
+    scopes TEXT NOT NULL DEFAULT '',
+    rate_limit_requests INTEGER NOT NULL DEFAULT 0,
+    rate_limit_period_seconds INTEGER NOT NULL DEFAULT 1,
+    rate_limit_burst INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    status_reason TEXT NOT NULL DEFAULT '',
+    status_changed_at TIMESTAMPTZ,
+    tokens_valid_after TIMESTAMPTZ,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Deployments from before versioned migrations created the table with
+-- fewer columns
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS signing_algorithm VARCHAR(16) NOT NULL DEFAULT 'HS256';
+-- TIMESTAMPTZ because it is compared against the iat claim
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS client_id VARCHAR(64) UNIQUE;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS client_secret_hash CHAR(64);
+-- 0 means only the service-wide ceiling applies
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS max_expiration_minutes INTEGER NOT NULL DEFAULT 0;
+-- Space separated, like the scope claim
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+-- 0 requests means the customer is not rate limited
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS rate_limit_requests INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS rate_limit_period_seconds INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS rate_limit_burst INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active';
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
@@ -0,0 +1,23 @@
+-- Versioned signing keys. customers.secret_key mirrors the active key so that
+-- older binaries keep working during a rollout.
+CREATE TABLE IF NOT EXISTS customer_keys (
+    id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    kid VARCHAR(64) UNIQUE NOT NULL DEFAULT md5(random()::text || clock_timestamp()::text),
+    version INTEGER NOT NULL,
+    secret_key TEXT NOT NULL,
+    signing_algorithm VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    verify_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMP,
+    UNIQUE (customer_id, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS customer_keys_one_active ON customer_keys (customer_id) WHERE status = 'active';
+
+-- Backfill a first key for customers created before versioned keys existed
+INSERT INTO customer_keys (customer_id, version, secret_key, signing_algorithm, status)
+SELECT c.customer_id, 1, c.secret_key, c.signing_algorithm, 'active'
+FROM customers c
+WHERE NOT EXISTS (SELECT 1 FROM customer_keys k WHERE k.customer_id = c.customer_id);
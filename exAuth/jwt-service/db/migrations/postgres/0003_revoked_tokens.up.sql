@@ -0,0 +1,12 @@
+-- Revoked token IDs (jti). Rows are only needed until the token would have
+-- expired anyway, after which PurgeExpiredRevokedTokens removes them.
+-- TIMESTAMPTZ because expires_at is written from the token's exp claim.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at ON revoked_tokens (expires_at);
@@ -0,0 +1,21 @@
+-- Refresh tokens are opaque; only their SHA-256 hash is stored. Every rotation
+-- adds a row to the same family so that replaying an old token can revoke all
+-- of its descendants.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    family_id VARCHAR(64) NOT NULL,
+    customer_id VARCHAR(255) NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS user_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_customer_id ON refresh_tokens (customer_id);
@@ -0,0 +1,9 @@
+-- Services allowed to call /introspect, kept separate from customers so that
+-- customer credentials cannot be used to probe other customers' tokens
+CREATE TABLE IF NOT EXISTS introspection_clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash CHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
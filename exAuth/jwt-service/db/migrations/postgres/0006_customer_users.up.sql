@@ -0,0 +1,9 @@
+-- Users that tokens can be issued for, scoped to a customer. A user ID only
+-- has to be unique within its customer.
+CREATE TABLE IF NOT EXISTS customer_users (
+    id SERIAL PRIMARY KEY,
+    customer_id VARCHAR(255) NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (customer_id, user_id)
+);
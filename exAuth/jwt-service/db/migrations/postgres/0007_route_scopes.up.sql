@@ -0,0 +1,11 @@
+-- Scopes required by the ext_authz check for requests to a route. An empty
+-- host or method matches any host or method.
+CREATE TABLE IF NOT EXISTS route_scopes (
+    id SERIAL PRIMARY KEY,
+    host VARCHAR(255) NOT NULL DEFAULT '',
+    path_prefix TEXT NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    scope VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, path_prefix, method)
+);
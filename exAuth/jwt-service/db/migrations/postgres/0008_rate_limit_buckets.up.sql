@@ -0,0 +1,7 @@
+-- Token buckets shared by all replicas when rate limits are kept in
+-- Postgres. A missing bucket is full, so idle buckets can be deleted.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
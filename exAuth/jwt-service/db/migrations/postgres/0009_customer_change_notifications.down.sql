@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS customer_keys_notify_change ON customer_keys;
+DROP TRIGGER IF EXISTS customers_notify_change ON customers;
+DROP FUNCTION IF EXISTS notify_customer_change();
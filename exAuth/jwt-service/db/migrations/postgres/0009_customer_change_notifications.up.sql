@@ -0,0 +1,22 @@
+-- Notify running services of the customer whose record or keys changed,
+-- so they drop it from their caches instead of waiting for it to expire
+CREATE OR REPLACE FUNCTION notify_customer_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('customer_changes', OLD.customer_id);
+    ELSE
+        PERFORM pg_notify('customer_changes', NEW.customer_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS customers_notify_change ON customers;
+CREATE TRIGGER customers_notify_change
+    AFTER UPDATE OR DELETE ON customers
+    FOR EACH ROW EXECUTE FUNCTION notify_customer_change();
+
+DROP TRIGGER IF EXISTS customer_keys_notify_change ON customer_keys;
+CREATE TRIGGER customer_keys_notify_change
+    AFTER INSERT OR UPDATE OR DELETE ON customer_keys
+    FOR EACH ROW EXECUTE FUNCTION notify_customer_change();
@@ -0,0 +1,3 @@
+-- Audience requested when the refresh token family was started, space
+-- separated. Empty means the service's audiences.
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS audience TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,23 @@
+-- SQLite stores times as UTC text, which sorts like the instants it
+-- represents
+CREATE TABLE IF NOT EXISTS customers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id VARCHAR(255) UNIQUE NOT NULL,
+    account_id VARCHAR(255) UNIQUE NOT NULL,
+    secret_key TEXT NOT NULL,
+    signing_algorithm VARCHAR(16) NOT NULL DEFAULT 'HS256',
+    client_id VARCHAR(64) UNIQUE,
+    client_secret_hash CHAR(64),
+    expiration_minutes INTEGER DEFAULT 60,
+    max_expiration_minutes INTEGER NOT NULL DEFAULT 0,
+    scopes TEXT NOT NULL DEFAULT '',
+    rate_limit_requests INTEGER NOT NULL DEFAULT 0,
+    rate_limit_period_seconds INTEGER NOT NULL DEFAULT 1,
+    rate_limit_burst INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    status_reason TEXT NOT NULL DEFAULT '',
+    status_changed_at TIMESTAMP,
+    tokens_valid_after TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
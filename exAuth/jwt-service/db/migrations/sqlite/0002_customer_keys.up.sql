@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS customer_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id VARCHAR(255) NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    kid VARCHAR(64) UNIQUE NOT NULL DEFAULT (lower(hex(randomblob(16)))),
+    version INTEGER NOT NULL,
+    secret_key TEXT NOT NULL,
+    signing_algorithm VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    verify_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMP,
+    UNIQUE (customer_id, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS customer_keys_one_active ON customer_keys (customer_id) WHERE status = 'active';
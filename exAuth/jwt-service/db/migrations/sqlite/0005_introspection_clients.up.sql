@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS introspection_clients (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash CHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
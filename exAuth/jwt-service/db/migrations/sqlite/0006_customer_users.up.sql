@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS customer_users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id VARCHAR(255) NOT NULL REFERENCES customers(customer_id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (customer_id, user_id)
+);
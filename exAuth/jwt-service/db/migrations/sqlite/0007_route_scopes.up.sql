@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS route_scopes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host VARCHAR(255) NOT NULL DEFAULT '',
+    path_prefix TEXT NOT NULL,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    scope VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, path_prefix, method)
+);
@@ -0,0 +1,3 @@
+-- SQLite has no LISTEN/NOTIFY. It only serves a single process, which
+-- drops its own changes from its caches.
+SELECT 1;
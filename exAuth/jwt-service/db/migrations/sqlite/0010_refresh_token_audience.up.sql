@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD COLUMN audience TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,70 @@
+package db
+
+import (
+    "context"
+    "errors"
+    "log"
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// customerChangesChannel is notified with the customer ID by the triggers
+// on customers and customer_keys
+const customerChangesChannel = "customer_changes"
+
+// ChangeNotifier is implemented by stores that can report changes made to
+// customers and their keys by other processes
+type ChangeNotifier interface {
+    // ListenForChanges calls onChange with the ID of every customer whose
+    // record or keys changed until ctx is done. An empty ID means changes
+    // may have been missed and every customer should be considered changed.
+    ListenForChanges(ctx context.Context, onChange func(customerID string)) error
+}
+
+var _ ChangeNotifier = (*Database)(nil)
+
+// ListenForChanges listens for the notifications of the change triggers on
+// a dedicated connection, which reconnects by itself
+func (d *Database) ListenForChanges(ctx context.Context, onChange func(customerID string)) error {
+    if d.sqlite {
+        return errors.New("SQLite cannot notify changes")
+    }
+
+    listener := pq.NewListener(d.url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+        if err != nil {
+            log.Printf("Customer change listener: %v", err)
+        }
+    })
+    if err := listener.Listen(customerChangesChannel); err != nil {
+        listener.Close()
+        return err
+    }
+
+    go func() {
+        defer listener.Close()
+
+        ping := time.NewTicker(time.Minute)
+        defer ping.Stop()
+
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case notification := <-listener.Notify:
+                // nil after a reconnect: notifications sent while the
+                // connection was down are lost
+                if notification == nil {
+                    onChange("")
+                    continue
+                }
+                onChange(notification.Extra)
+            case <-ping.C:
+                // Notices a silently dropped connection
+                go listener.Ping()
+            }
+        }
+    }()
+
+    return nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+    "database/sql"
+    "errors"
+    "time"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+// UpdateRateLimitBucket locks the bucket, passes it to update together with
+// the database time and stores the result. Missing buckets start with
+// capacity tokens. The database clock is used so that replicas with skewed
+// clocks refill buckets consistently.
+func (d *Database) UpdateRateLimitBucket(key string, capacity float64, update func(bucket *models.RateLimitBucket, now time.Time)) error {
+    if d.sqlite {
+        return d.updateSQLiteRateLimitBucket(key, capacity, update)
+    }
+
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    insertQuery := `
+        INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+        VALUES ($1, $2, clock_timestamp())
+        ON CONFLICT (bucket_key) DO NOTHING
+    `
+    if _, err = tx.Exec(insertQuery, key, capacity); err != nil {
+        return err
+    }
+
+    // clock_timestamp() rather than CURRENT_TIMESTAMP, which is the start of
+    // the transaction and may predate the last update if we waited for the lock
+    selectQuery := `SELECT tokens, updated_at, clock_timestamp() FROM rate_limit_buckets WHERE bucket_key = $1 FOR UPDATE`
+
+    bucket := &models.RateLimitBucket{Key: key}
+    var now time.Time
+    if err = tx.QueryRow(selectQuery, key).Scan(&bucket.Tokens, &bucket.UpdatedAt, &now); err != nil {
+        return err
+    }
+
+    update(bucket, now)
+
+    updateQuery := `UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE bucket_key = $1`
+    if _, err = tx.Exec(updateQuery, key, bucket.Tokens, bucket.UpdatedAt); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// updateSQLiteRateLimitBucket is UpdateRateLimitBucket for SQLite, which is
+// only used by a single process and has no sub-second clock function, so the
+// local clock is used instead
+func (d *Database) updateSQLiteRateLimitBucket(key string, capacity float64, update func(bucket *models.RateLimitBucket, now time.Time)) error {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    now := time.Now().UTC()
+    bucket := &models.RateLimitBucket{Key: key}
+    err = tx.QueryRow(`SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = $1`, key).Scan(&bucket.Tokens, &bucket.UpdatedAt)
+    if errors.Is(err, sql.ErrNoRows) {
+        bucket.Tokens = capacity
+        bucket.UpdatedAt = now
+    } else if err != nil {
+        return err
+    }
+
+    update(bucket, now)
+
+    upsertQuery := `
+        INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (bucket_key) DO UPDATE SET tokens = excluded.tokens, updated_at = excluded.updated_at
+    `
+    if _, err = tx.Exec(upsertQuery, key, bucket.Tokens, bucket.UpdatedAt.UTC()); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// PurgeIdleRateLimitBuckets deletes buckets that have not been used for the
+// given duration and returns how many were removed. Buckets idle for longer
+// than their refill time are full, so deleting them changes nothing.
+func (d *Database) PurgeIdleRateLimitBuckets(idle time.Duration) (int64, error) {
+    query := `DELETE FROM rate_limit_buckets WHERE updated_at < clock_timestamp() - $1 * INTERVAL '1 second'`
+    var arg interface{} = idle.Seconds()
+    if d.sqlite {
+        query = `DELETE FROM rate_limit_buckets WHERE updated_at < $1`
+        arg = time.Now().Add(-idle).UTC()
+    }
+
+    result, err := d.DB.Exec(query, arg)
+    if err != nil {
+        return 0, err
+    }
+
+    return result.RowsAffected()
+}
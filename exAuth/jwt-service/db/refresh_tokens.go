@@ -0,0 +1,147 @@
+package db
+
+import (
+    "database/sql"
+    "errors"
+    "strings"
+    "time"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+// ErrRefreshTokenReused is returned by RotateRefreshToken when a refresh token
+// that was already exchanged is presented again. The whole family is revoked.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// CreateRefreshToken stores the hash of a new refresh token
+func (d *Database) CreateRefreshToken(tokenHash string, token *models.RefreshToken) error {
+    query := `
+        INSERT INTO refresh_tokens (token_hash, family_id, customer_id, user_id, scopes, audience, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+
+    _, err := d.DB.Exec(query,
+        tokenHash,
+        token.FamilyID,
+        token.CustomerID,
+        token.UserID,
+        strings.Join(token.Scopes, " "),
+        strings.Join(token.Audience, " "),
+        token.ExpiresAt.UTC(),
+    )
+
+    return err
+}
+
+// GetRefreshToken returns a refresh token without exchanging it. Unknown,
+// expired and revoked tokens return sql.ErrNoRows; a token that was already
+// used returns ErrRefreshTokenReused along with the token, its family is only
+// revoked by RotateRefreshToken.
+func (d *Database) GetRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+    query := `
+        SELECT family_id, customer_id, user_id, scopes, audience, expires_at, expires_at <= CURRENT_TIMESTAMP, used_at IS NOT NULL, revoked_at IS NOT NULL
+        FROM refresh_tokens WHERE token_hash = $1`
+
+    token := &models.RefreshToken{}
+    var scopes, audience string
+    var expired, used, revoked bool
+    err := d.DB.QueryRow(query, tokenHash).Scan(&token.FamilyID, &token.CustomerID, &token.UserID, &scopes, &audience, &token.ExpiresAt, &expired, &used, &revoked)
+    if err != nil {
+        return nil, err
+    }
+    token.Scopes = strings.Fields(scopes)
+    token.Audience = strings.Fields(audience)
+
+    switch {
+    case revoked:
+        return nil, sql.ErrNoRows
+    case used:
+        return token, ErrRefreshTokenReused
+    case expired:
+        return nil, sql.ErrNoRows
+    }
+
+    return token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// family and returns the new token. Unknown, expired and revoked tokens return
+// sql.ErrNoRows; a token that was already used revokes its family and returns
+// ErrRefreshTokenReused along with the token.
+func (d *Database) RotateRefreshToken(tokenHash, newTokenHash string, expiresAt time.Time) (*models.RefreshToken, error) {
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    query := `
+        SELECT family_id, customer_id, user_id, scopes, audience, expires_at <= CURRENT_TIMESTAMP, used_at IS NOT NULL, revoked_at IS NOT NULL
+        FROM refresh_tokens WHERE token_hash = $1` + d.forUpdate()
+
+    token := &models.RefreshToken{}
+    var scopes, audience string
+    var expired, used, revoked bool
+    err = tx.QueryRow(query, tokenHash).Scan(&token.FamilyID, &token.CustomerID, &token.UserID, &scopes, &audience, &expired, &used, &revoked)
+    if err != nil {
+        return nil, err
+    }
+    token.Scopes = strings.Fields(scopes)
+    token.Audience = strings.Fields(audience)
+
+    if revoked {
+        return nil, sql.ErrNoRows
+    }
+
+    if used {
+        revokeQuery := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE family_id = $1 AND revoked_at IS NULL`
+        if _, err := tx.Exec(revokeQuery, token.FamilyID); err != nil {
+            return nil, err
+        }
+        if err := tx.Commit(); err != nil {
+            return nil, err
+        }
+        return token, ErrRefreshTokenReused
+    }
+
+    if expired {
+        return nil, sql.ErrNoRows
+    }
+
+    if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE token_hash = $1`, tokenHash); err != nil {
+        return nil, err
+    }
+
+    insertQuery := `
+        INSERT INTO refresh_tokens (token_hash, family_id, customer_id, user_id, scopes, audience, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+    if _, err := tx.Exec(insertQuery, newTokenHash, token.FamilyID, token.CustomerID, token.UserID, scopes, audience, expiresAt.UTC()); err != nil {
+        return nil, err
+    }
+    token.ExpiresAt = expiresAt
+
+    return token, tx.Commit()
+}
+
+// RevokeCustomerRefreshTokens revokes every outstanding refresh token of a
+// customer
+func (d *Database) RevokeCustomerRefreshTokens(customerID string) error {
+    query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE customer_id = $1 AND revoked_at IS NULL`
+
+    _, err := d.DB.Exec(query, customerID)
+
+    return err
+}
+
+// PurgeExpiredRefreshTokens deletes refresh tokens that can no longer be
+// exchanged and returns how many were removed. Rows of a family are kept until
+// they expire so reuse can still be detected.
+func (d *Database) PurgeExpiredRefreshTokens() (int64, error) {
+    result, err := d.DB.Exec(`DELETE FROM refresh_tokens WHERE expires_at <= CURRENT_TIMESTAMP`)
+    if err != nil {
+        return 0, err
+    }
+
+    return result.RowsAffected()
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+    "time"
+)
+
+// RevokeToken adds a token ID to the denylist. Revoking an already revoked
+// token is a no-op.
+func (d *Database) RevokeToken(jti, customerID, reason string, expiresAt time.Time) error {
+    query := `
+        INSERT INTO revoked_tokens (jti, customer_id, reason, expires_at)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (jti) DO NOTHING
+    `
+
+    _, err := d.DB.Exec(query, jti, customerID, reason, expiresAt.UTC())
+
+    return err
+}
+
+// ListRevokedTokens returns the IDs and expiry of every revoked token that
+// has not expired yet
+func (d *Database) ListRevokedTokens() (map[string]time.Time, error) {
+    query := `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > CURRENT_TIMESTAMP`
+
+    rows, err := d.DB.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    revoked := make(map[string]time.Time)
+    for rows.Next() {
+        var jti string
+        var expiresAt time.Time
+        if err := rows.Scan(&jti, &expiresAt); err != nil {
+            return nil, err
+        }
+        revoked[jti] = expiresAt
+    }
+
+    return revoked, rows.Err()
+}
+
+// PurgeExpiredRevokedTokens deletes denylist entries for tokens that have
+// expired and returns how many were removed
+func (d *Database) PurgeExpiredRevokedTokens() (int64, error) {
+    result, err := d.DB.Exec(`DELETE FROM revoked_tokens WHERE expires_at <= CURRENT_TIMESTAMP`)
+    if err != nil {
+        return 0, err
+    }
+
+    return result.RowsAffected()
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+    "database/sql"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+func (d *Database) CreateRouteScope(route *models.RouteScope) error {
+    query := `
+        INSERT INTO route_scopes (host, path_prefix, method, scope)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at
+    `
+
+    return d.DB.QueryRow(query, route.Host, route.PathPrefix, route.Method, route.Scope).Scan(&route.ID, &route.CreatedAt)
+}
+
+func (d *Database) ListRouteScopes() ([]*models.RouteScope, error) {
+    query := `SELECT id, host, path_prefix, method, scope, created_at FROM route_scopes ORDER BY host, path_prefix, method`
+
+    rows, err := d.DB.Query(query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var routes []*models.RouteScope
+    for rows.Next() {
+        route := &models.RouteScope{}
+        if err := rows.Scan(&route.ID, &route.Host, &route.PathPrefix, &route.Method, &route.Scope, &route.CreatedAt); err != nil {
+            return nil, err
+        }
+        routes = append(routes, route)
+    }
+
+    return routes, rows.Err()
+}
+
+func (d *Database) DeleteRouteScope(id int64) error {
+    result, err := d.DB.Exec(`DELETE FROM route_scopes WHERE id = $1`, id)
+    if err != nil {
+        return err
+    }
+
+    deleted, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if deleted == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
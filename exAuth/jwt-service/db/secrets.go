@@ -0,0 +1,364 @@
+package db
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Signing secrets are stored with envelope encryption: every secret is
+// sealed with AES-256-GCM under its own random data key, bound to the
+// customer ID, and the data key is wrapped by a master key. Rotating the
+// master key only rewraps the data keys. Stored values look like
+//
+//     enc:v1:<wrapped data key>:<nonce and ciphertext>:<master key ID>
+//
+// Values without the prefix are plaintext from before encryption was
+// enabled. They are still read until secrets-reencrypt encrypts them.
+const encryptedSecretPrefix = "enc:v1:"
+
+// ErrMasterKeyRequired is returned when an encrypted secret is read, or
+// secrets are reencrypted, without a master key configured
+var ErrMasterKeyRequired = errors.New("secret is encrypted but no master key is configured")
+
+// KeyWrapper protects data keys with a master key. LocalKeyWrapper holds the
+// master key in process; a KMS can implement it without the key ever
+// leaving the KMS.
+type KeyWrapper interface {
+    // KeyID names the master key. It is stored next to every wrapped data
+    // key so that the right master key is used to unwrap it.
+    KeyID() string
+    WrapKey(dataKey []byte) ([]byte, error)
+    UnwrapKey(wrappedKey []byte) ([]byte, error)
+}
+
+// LocalKeyWrapper wraps data keys with a 256-bit master key using AES-GCM
+type LocalKeyWrapper struct {
+    id   string
+    aead cipher.AEAD
+}
+
+func NewLocalKeyWrapper(masterKey []byte) (*LocalKeyWrapper, error) {
+    if len(masterKey) != 32 {
+        return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+    }
+
+    aead, err := newAEAD(masterKey)
+    if err != nil {
+        return nil, err
+    }
+
+    // The ID only has to tell master keys apart, a digest prefix is enough
+    sum := sha256.Sum256(masterKey)
+    return &LocalKeyWrapper{id: "local-" + hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+func (w *LocalKeyWrapper) KeyID() string {
+    return w.id
+}
+
+func (w *LocalKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+    return seal(w.aead, dataKey, nil)
+}
+
+func (w *LocalKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+    return open(w.aead, wrappedKey, nil)
+}
+
+// LoadMasterKey reads a base64 encoded 32 byte master key from value or,
+// when value is empty, from the file at path. It returns nil when neither
+// is set.
+func LoadMasterKey(value, path string) (KeyWrapper, error) {
+    if value == "" && path != "" {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read master key: %w", err)
+        }
+        value = string(data)
+    }
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return nil, nil
+    }
+
+    masterKey, err := base64.StdEncoding.DecodeString(value)
+    if err != nil {
+        return nil, fmt.Errorf("master key is not valid base64: %w", err)
+    }
+
+    wrapper, err := NewLocalKeyWrapper(masterKey)
+    if err != nil {
+        return nil, err
+    }
+    return wrapper, nil
+}
+
+// SecretCipher encrypts secrets under the primary master key and decrypts
+// secrets under the primary or any previous master key, so that the
+// service keeps working while secrets-reencrypt moves rows to a new key
+type SecretCipher struct {
+    primary  KeyWrapper
+    wrappers map[string]KeyWrapper
+}
+
+func NewSecretCipher(primary KeyWrapper, previous ...KeyWrapper) *SecretCipher {
+    c := &SecretCipher{primary: primary, wrappers: map[string]KeyWrapper{primary.KeyID(): primary}}
+    for _, wrapper := range previous {
+        if _, ok := c.wrappers[wrapper.KeyID()]; !ok {
+            c.wrappers[wrapper.KeyID()] = wrapper
+        }
+    }
+    return c
+}
+
+// LoadSecretCipher builds a SecretCipher from the master key and an optional
+// previous master key, each given as a value or a file as for
+// LoadMasterKey. It returns nil when no master key is set.
+func LoadSecretCipher(masterKey, masterKeyFile, previousKey, previousKeyFile string) (*SecretCipher, error) {
+    primary, err := LoadMasterKey(masterKey, masterKeyFile)
+    if err != nil {
+        return nil, err
+    }
+    previous, err := LoadMasterKey(previousKey, previousKeyFile)
+    if err != nil {
+        return nil, fmt.Errorf("previous %w", err)
+    }
+
+    if primary == nil {
+        if previous != nil {
+            return nil, errors.New("a previous master key is set without a master key")
+        }
+        return nil, nil
+    }
+    if previous == nil {
+        return NewSecretCipher(primary), nil
+    }
+    return NewSecretCipher(primary, previous), nil
+}
+
+// encrypt seals the secret under a new data key wrapped by the primary
+// master key
+func (c *SecretCipher) encrypt(secret, customerID string) (string, error) {
+    dataKey := make([]byte, 32)
+    if _, err := rand.Read(dataKey); err != nil {
+        return "", err
+    }
+
+    aead, err := newAEAD(dataKey)
+    if err != nil {
+        return "", err
+    }
+    ciphertext, err := seal(aead, []byte(secret), []byte(customerID))
+    if err != nil {
+        return "", err
+    }
+
+    wrappedKey, err := c.primary.WrapKey(dataKey)
+    if err != nil {
+        return "", fmt.Errorf("failed to wrap data key: %w", err)
+    }
+
+    return formatSecret(wrappedKey, ciphertext, c.primary.KeyID()), nil
+}
+
+// decrypt returns the plaintext of a stored secret
+func (c *SecretCipher) decrypt(stored, customerID string) (string, error) {
+    wrappedKey, ciphertext, keyID, err := parseSecret(stored)
+    if err != nil {
+        return "", err
+    }
+
+    dataKey, err := c.unwrap(wrappedKey, keyID)
+    if err != nil {
+        return "", err
+    }
+
+    aead, err := newAEAD(dataKey)
+    if err != nil {
+        return "", err
+    }
+    secret, err := open(aead, ciphertext, []byte(customerID))
+    if err != nil {
+        return "", fmt.Errorf("failed to decrypt secret: %w", err)
+    }
+
+    return string(secret), nil
+}
+
+// reencrypt puts a stored secret under the primary master key. Plaintext is
+// encrypted, data keys of other master keys are rewrapped and secrets that
+// already use the primary key are returned unchanged with false.
+func (c *SecretCipher) reencrypt(stored, customerID string) (string, bool, error) {
+    if !strings.HasPrefix(stored, encryptedSecretPrefix) {
+        encrypted, err := c.encrypt(stored, customerID)
+        return encrypted, err == nil, err
+    }
+
+    wrappedKey, ciphertext, keyID, err := parseSecret(stored)
+    if err != nil {
+        return "", false, err
+    }
+    if keyID == c.primary.KeyID() {
+        return stored, false, nil
+    }
+
+    dataKey, err := c.unwrap(wrappedKey, keyID)
+    if err != nil {
+        return "", false, err
+    }
+    wrappedKey, err = c.primary.WrapKey(dataKey)
+    if err != nil {
+        return "", false, fmt.Errorf("failed to wrap data key: %w", err)
+    }
+
+    return formatSecret(wrappedKey, ciphertext, c.primary.KeyID()), true, nil
+}
+
+func (c *SecretCipher) unwrap(wrappedKey []byte, keyID string) ([]byte, error) {
+    wrapper, ok := c.wrappers[keyID]
+    if !ok {
+        return nil, fmt.Errorf("secret is encrypted with unknown master key %s", keyID)
+    }
+
+    dataKey, err := wrapper.UnwrapKey(wrappedKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+    }
+
+    return dataKey, nil
+}
+
+func formatSecret(wrappedKey, ciphertext []byte, keyID string) string {
+    return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+        base64.StdEncoding.EncodeToString(ciphertext) + ":" + keyID
+}
+
+// parseSecret splits an encrypted secret. The key ID comes last since KMS
+// key IDs may contain colons.
+func parseSecret(stored string) ([]byte, []byte, string, error) {
+    parts := strings.SplitN(strings.TrimPrefix(stored, encryptedSecretPrefix), ":", 3)
+    if len(parts) != 3 {
+        return nil, nil, "", errors.New("malformed encrypted secret")
+    }
+
+    wrappedKey, err := base64.StdEncoding.DecodeString(parts[0])
+    if err != nil {
+        return nil, nil, "", fmt.Errorf("malformed encrypted secret: %w", err)
+    }
+    ciphertext, err := base64.StdEncoding.DecodeString(parts[1])
+    if err != nil {
+        return nil, nil, "", fmt.Errorf("malformed encrypted secret: %w", err)
+    }
+
+    return wrappedKey, ciphertext, parts[2], nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// seal prepends a random nonce to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+    nonce := make([]byte, aead.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, err
+    }
+    return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+    if len(sealed) < aead.NonceSize() {
+        return nil, errors.New("ciphertext too short")
+    }
+    nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+    return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// encryptSecret returns what to store for a secret: its encryption when a
+// master key is configured, otherwise the plaintext
+func (d *Database) encryptSecret(secret, customerID string) (string, error) {
+    if d.Secrets == nil {
+        return secret, nil
+    }
+    return d.Secrets.encrypt(secret, customerID)
+}
+
+// decryptSecret returns the plaintext of a stored secret
+func (d *Database) decryptSecret(stored, customerID string) (string, error) {
+    if !strings.HasPrefix(stored, encryptedSecretPrefix) {
+        return stored, nil
+    }
+    if d.Secrets == nil {
+        return "", ErrMasterKeyRequired
+    }
+    return d.Secrets.decrypt(stored, customerID)
+}
+
+// ReencryptSecrets puts every stored signing secret under the primary
+// master key: plaintext secrets are encrypted and data keys wrapped by a
+// previous master key are rewrapped. It returns how many secrets changed.
+func (d *Database) ReencryptSecrets() (int, error) {
+    if d.Secrets == nil {
+        return 0, ErrMasterKeyRequired
+    }
+
+    tx, err := d.DB.Begin()
+    if err != nil {
+        return 0, err
+    }
+    defer tx.Rollback()
+
+    type storedSecret struct {
+        id         int64
+        customerID string
+        secretKey  string
+    }
+
+    changed := 0
+    for _, table := range []string{"customers", "customer_keys"} {
+        rows, err := tx.Query(`SELECT id, customer_id, secret_key FROM ` + table + ` ORDER BY id` + d.forUpdate())
+        if err != nil {
+            return 0, err
+        }
+        var secrets []storedSecret
+        for rows.Next() {
+            var secret storedSecret
+            if err := rows.Scan(&secret.id, &secret.customerID, &secret.secretKey); err != nil {
+                rows.Close()
+                return 0, err
+            }
+            secrets = append(secrets, secret)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return 0, err
+        }
+
+        for _, secret := range secrets {
+            reencrypted, ok, err := d.Secrets.reencrypt(secret.secretKey, secret.customerID)
+            if err != nil {
+                return 0, fmt.Errorf("%s %d of customer %s: %w", table, secret.id, secret.customerID, err)
+            }
+            if !ok {
+                continue
+            }
+            if _, err := tx.Exec(`UPDATE `+table+` SET secret_key = $2 WHERE id = $1`, secret.id, reencrypted); err != nil {
+                return 0, err
+            }
+            changed++
+        }
+    }
+
+    return changed, tx.Commit()
+}
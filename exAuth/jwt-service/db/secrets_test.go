@@ -0,0 +1,105 @@
+package db
+
+import (
+    "bytes"
+    "encoding/base64"
+    "errors"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func newTestKeyWrapper(t *testing.T, fill byte) KeyWrapper {
+    wrapper, err := NewLocalKeyWrapper(bytes.Repeat([]byte{fill}, 32))
+    assert.NoError(t, err)
+    return wrapper
+}
+
+func TestSecretCipher(t *testing.T) {
+    secrets := NewSecretCipher(newTestKeyWrapper(t, 1))
+
+    stored, err := secrets.encrypt("signing-secret", "acme")
+    assert.NoError(t, err)
+    assert.True(t, strings.HasPrefix(stored, encryptedSecretPrefix))
+    assert.NotContains(t, stored, "signing-secret")
+
+    secret, err := secrets.decrypt(stored, "acme")
+    assert.NoError(t, err)
+    assert.Equal(t, "signing-secret", secret)
+
+    // A secret copied to another customer's row does not decrypt
+    _, err = secrets.decrypt(stored, "globex")
+    assert.Error(t, err)
+
+    // Every secret gets its own data key
+    again, _ := secrets.encrypt("signing-secret", "acme")
+    assert.NotEqual(t, stored, again)
+}
+
+func TestSecretCipherReencrypt(t *testing.T) {
+    oldKey, newKey := newTestKeyWrapper(t, 1), newTestKeyWrapper(t, 2)
+    stored, err := NewSecretCipher(oldKey).encrypt("signing-secret", "acme")
+    assert.NoError(t, err)
+
+    // Without the previous key the new cipher cannot read the secret
+    _, err = NewSecretCipher(newKey).decrypt(stored, "acme")
+    assert.Error(t, err)
+
+    rotating := NewSecretCipher(newKey, oldKey)
+    secret, err := rotating.decrypt(stored, "acme")
+    assert.NoError(t, err)
+    assert.Equal(t, "signing-secret", secret)
+
+    rewrapped, changed, err := rotating.reencrypt(stored, "acme")
+    assert.NoError(t, err)
+    assert.True(t, changed)
+    assert.True(t, strings.HasSuffix(rewrapped, ":"+newKey.KeyID()))
+    secret, err = NewSecretCipher(newKey).decrypt(rewrapped, "acme")
+    assert.NoError(t, err)
+    assert.Equal(t, "signing-secret", secret)
+
+    _, changed, err = rotating.reencrypt(rewrapped, "acme")
+    assert.NoError(t, err)
+    assert.False(t, changed)
+
+    // Plaintext from before encryption was enabled is encrypted
+    encrypted, changed, err := rotating.reencrypt("plain-secret", "acme")
+    assert.NoError(t, err)
+    assert.True(t, changed)
+    secret, _ = rotating.decrypt(encrypted, "acme")
+    assert.Equal(t, "plain-secret", secret)
+}
+
+func TestDatabaseDecryptSecret(t *testing.T) {
+    database := &Database{}
+    secret, err := database.decryptSecret("plain-secret", "acme")
+    assert.NoError(t, err)
+    assert.Equal(t, "plain-secret", secret)
+
+    stored, err := NewSecretCipher(newTestKeyWrapper(t, 1)).encrypt("signing-secret", "acme")
+    assert.NoError(t, err)
+    _, err = database.decryptSecret(stored, "acme")
+    assert.True(t, errors.Is(err, ErrMasterKeyRequired))
+}
+
+func TestLoadSecretCipher(t *testing.T) {
+    secrets, err := LoadSecretCipher("", "", "", "")
+    assert.NoError(t, err)
+    assert.Nil(t, secrets)
+
+    masterKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+    path := filepath.Join(t.TempDir(), "master-key")
+    assert.NoError(t, os.WriteFile(path, []byte(masterKey+"\n"), 0600))
+
+    secrets, err = LoadSecretCipher("", path, "", "")
+    assert.NoError(t, err)
+    assert.Equal(t, newTestKeyWrapper(t, 1).KeyID(), secrets.primary.KeyID())
+
+    _, err = LoadSecretCipher(base64.StdEncoding.EncodeToString([]byte("short")), "", "", "")
+    assert.Error(t, err)
+    _, err = LoadSecretCipher("", "", masterKey, "")
+    assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+    "database/sql"
+
+    // Registers the "sqlite" database/sql driver, pure Go so builds need no cgo
+    _ "modernc.org/sqlite"
+)
+
+// NewSQLiteDatabase opens the SQLite database file at path, creating it if
+// needed, and applies pending migrations
+func NewSQLiteDatabase(path string) (*Database, error) {
+    database, err := connectSQLite(path)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := database.MigrateUp(); err != nil {
+        database.Close()
+        return nil, err
+    }
+
+    return database, nil
+}
+
+func connectSQLite(path string) (*Database, error) {
+    db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite")
+    if err != nil {
+        return nil, err
+    }
+
+    // SQLite has a single writer. With one connection transactions run one
+    // after the other, which stands in for the row locks used on Postgres.
+    db.SetMaxOpenConns(1)
+
+    if err = db.Ping(); err != nil {
+        db.Close()
+        return nil, err
+    }
+
+    return &Database{DB: db, sqlite: true}, nil
+}
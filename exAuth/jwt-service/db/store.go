@@ -0,0 +1,110 @@
+package db
+
+import (
+    "strings"
+    "time"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+// CustomerStore is everything the service keeps about customers, their keys
+// and tokens. Database implements it on Postgres or SQLite, MemoryStore in
+// memory. Lookups of unknown records return sql.ErrNoRows.
+type CustomerStore interface {
+    // Customers
+    CreateCustomer(customer *models.Customer, kid string) error
+    GetCustomerByID(customerID string) (*models.Customer, error)
+    GetCustomerByClientID(clientID string) (*models.Customer, error)
+    GetSecretKeyForCustomer(customerID string) (string, string, error)
+    ListCustomers() ([]*models.Customer, error)
+    ListCustomersPage(limit, offset int) ([]*models.Customer, error)
+    UpdateCustomer(customer *models.Customer) error
+    SetClientCredentials(customerID, clientID, clientSecretHash string) error
+    SetCustomerScopes(customerID string, scopes []string) error
+    SetCustomerRateLimit(customerID string, requests, periodSeconds, burst int) error
+    SetCustomerStatus(customerID, status, reason string) error
+    RevokeAllCustomerTokens(customerID string) (time.Time, error)
+    DisableCustomer(customerID, reason string) (time.Time, error)
+    DeleteCustomer(customerID string) error
+
+    // Signing keys
+    GetActiveKeyForCustomer(customerID string) (*models.CustomerKey, error)
+    GetVerificationKey(kid string) (*models.CustomerKey, error)
+    ListVerificationKeys(customerID string) ([]*models.CustomerKey, error)
+    ListCustomerKeys(customerID string) ([]*models.CustomerKey, error)
+    RotateCustomerKey(customerID, kid, secretKey, algorithm string, overlap time.Duration) (*models.CustomerKey, error)
+
+    // Revoked and refresh tokens
+    RevokeToken(jti, customerID, reason string, expiresAt time.Time) error
+    ListRevokedTokens() (map[string]time.Time, error)
+    PurgeExpiredRevokedTokens() (int64, error)
+    CreateRefreshToken(tokenHash string, token *models.RefreshToken) error
+    GetRefreshToken(tokenHash string) (*models.RefreshToken, error)
+    RotateRefreshToken(tokenHash, newTokenHash string, expiresAt time.Time) (*models.RefreshToken, error)
+    RevokeCustomerRefreshTokens(customerID string) error
+    PurgeExpiredRefreshTokens() (int64, error)
+
+    // Users
+    CreateUser(user *models.User) error
+    GetUser(customerID, userID string) (*models.User, error)
+    ListUsers(customerID string) ([]*models.User, error)
+    DeleteUser(customerID, userID string) error
+
+    // Route scopes
+    CreateRouteScope(route *models.RouteScope) error
+    ListRouteScopes() ([]*models.RouteScope, error)
+    DeleteRouteScope(id int64) error
+
+    // Introspection clients
+    CreateIntrospectionClient(client *models.IntrospectionClient) error
+    GetIntrospectionClient(clientID string) (*models.IntrospectionClient, error)
+    ListIntrospectionClients() ([]*models.IntrospectionClient, error)
+    DeleteIntrospectionClient(clientID string) error
+
+    // Rate limit buckets
+    UpdateRateLimitBucket(key string, capacity float64, update func(bucket *models.RateLimitBucket, now time.Time)) error
+    PurgeIdleRateLimitBuckets(idle time.Duration) (int64, error)
+
+    // Ping checks that the store can be reached
+    Ping() error
+    Close()
+}
+
+var (
+    _ CustomerStore = (*Database)(nil)
+    _ CustomerStore = (*MemoryStore)(nil)
+)
+
+// Open connects to the store named by url: "memory:" for an in-memory
+// store, "sqlite:<path>" for a SQLite file and anything else for Postgres.
+// Databases encrypt signing secrets with secrets when it is not nil; the
+// in-memory store keeps nothing at rest and ignores it.
+func Open(url string, secrets *SecretCipher) (CustomerStore, error) {
+    if url == "memory:" || url == "memory://" {
+        return NewMemoryStore(), nil
+    }
+
+    if path, ok := sqlitePath(url); ok {
+        database, err := NewSQLiteDatabase(path)
+        if err != nil {
+            return nil, err
+        }
+        database.Secrets = secrets
+        return database, nil
+    }
+
+    database, err := NewDatabase(url)
+    if err != nil {
+        return nil, err
+    }
+    database.Secrets = secrets
+    return database, nil
+}
+
+// sqlitePath returns the file of "sqlite:<path>" and "sqlite://<path>" URLs
+func sqlitePath(url string) (string, bool) {
+    if !strings.HasPrefix(url, "sqlite:") {
+        return "", false
+    }
+    return strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//"), true
+}
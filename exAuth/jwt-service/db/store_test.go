@@ -0,0 +1,242 @@
+package db
+
+import (
+    "database/sql"
+    "errors"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+    "github.com/vishalk17/jwt-service/models"
+)
+
+// The same tests run against every CustomerStore implementation
+func TestMemoryStoreContract(t *testing.T) {
+    testCustomerStore(t, func(t *testing.T) CustomerStore { return NewMemoryStore() })
+}
+
+func TestSQLiteStoreContract(t *testing.T) {
+    testCustomerStore(t, func(t *testing.T) CustomerStore {
+        database, err := NewSQLiteDatabase(filepath.Join(t.TempDir(), "jwt-service.db"))
+        require.NoError(t, err)
+        t.Cleanup(database.Close)
+        return database
+    })
+}
+
+func TestSQLiteStoreEncryptedSecrets(t *testing.T) {
+    database, err := NewSQLiteDatabase(filepath.Join(t.TempDir(), "jwt-service.db"))
+    require.NoError(t, err)
+    defer database.Close()
+
+    database.Secrets = NewSecretCipher(newTestKeyWrapper(t, 1))
+    require.NoError(t, database.CreateCustomer(&models.Customer{CustomerID: "acme", AccountID: "acme-account", SecretKey: "secret", SigningAlgorithm: "HS256", ExpirationMinutes: 60}, "kid-1"))
+
+    var stored string
+    require.NoError(t, database.DB.QueryRow(`SELECT secret_key FROM customer_keys WHERE kid = 'kid-1'`).Scan(&stored))
+    assert.NotContains(t, stored, "secret")
+    key, err := database.GetActiveKeyForCustomer("acme")
+    require.NoError(t, err)
+    assert.Equal(t, "secret", key.SecretKey)
+}
+
+func testCustomerStore(t *testing.T, newStore func(t *testing.T) CustomerStore) {
+    newCustomer := func(customerID string) *models.Customer {
+        return &models.Customer{CustomerID: customerID, AccountID: customerID + "-account", SecretKey: "secret-" + customerID, SigningAlgorithm: "HS256", ExpirationMinutes: 60}
+    }
+
+    t.Run("customers", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+        assert.Equal(t, ErrCustomerExists, store.CreateCustomer(newCustomer("acme"), "kid-2"))
+
+        customer, err := store.GetCustomerByID("acme")
+        require.NoError(t, err)
+        assert.Equal(t, models.CustomerStatusActive, customer.Status)
+        _, err = store.GetCustomerByID("globex")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+        require.NoError(t, store.SetClientCredentials("acme", "acme-client", "hash"))
+        customer, err = store.GetCustomerByClientID("acme-client")
+        require.NoError(t, err)
+        assert.Equal(t, "acme", customer.CustomerID)
+
+        customer.ExpirationMinutes = 30
+        require.NoError(t, store.UpdateCustomer(customer))
+        require.NoError(t, store.SetCustomerScopes("acme", []string{"read", "write"}))
+        require.NoError(t, store.SetCustomerRateLimit("acme", 100, 60, 10))
+        customer, err = store.GetCustomerByID("acme")
+        require.NoError(t, err)
+        assert.Equal(t, []string{"read", "write"}, customer.Scopes)
+        assert.Equal(t, 100, customer.RateLimitRequests)
+        assert.Equal(t, 30, customer.ExpirationMinutes)
+
+        require.NoError(t, store.SetCustomerStatus("acme", models.CustomerStatusSuspended, "unpaid invoice"))
+        customer, _ = store.GetCustomerByID("acme")
+        assert.Equal(t, models.CustomerStatusSuspended, customer.Status)
+        assert.Equal(t, "unpaid invoice", customer.StatusReason)
+        assert.True(t, errors.Is(store.SetCustomerStatus("globex", models.CustomerStatusActive, ""), sql.ErrNoRows))
+
+        require.NoError(t, store.CreateCustomer(newCustomer("globex"), "kid-2"))
+        first, err := store.ListCustomersPage(1, 0)
+        require.NoError(t, err)
+        second, err := store.ListCustomersPage(1, 1)
+        require.NoError(t, err)
+        require.Len(t, first, 1)
+        require.Len(t, second, 1)
+        assert.NotEqual(t, first[0].CustomerID, second[0].CustomerID)
+
+        require.NoError(t, store.DeleteCustomer("globex"))
+        assert.True(t, errors.Is(store.DeleteCustomer("globex"), sql.ErrNoRows))
+    })
+
+    t.Run("disable", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+        require.NoError(t, store.CreateRefreshToken("refresh", &models.RefreshToken{FamilyID: "family", CustomerID: "acme", ExpiresAt: time.Now().Add(time.Hour)}))
+
+        before := time.Now().Truncate(time.Second)
+        validAfter, err := store.DisableCustomer("acme", "offboarded")
+        require.NoError(t, err)
+        assert.False(t, validAfter.Before(before))
+
+        customer, err := store.GetCustomerByID("acme")
+        require.NoError(t, err)
+        assert.Equal(t, models.CustomerStatusDisabled, customer.Status)
+        require.NotNil(t, customer.TokensValidAfter)
+        assert.True(t, validAfter.Equal(*customer.TokensValidAfter))
+        _, err = store.GetRefreshToken("refresh")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+        _, err = store.DisableCustomer("globex", "")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+    })
+
+    t.Run("keys", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+
+        key, err := store.RotateCustomerKey("acme", "kid-2", "v2", "HS256", time.Hour)
+        require.NoError(t, err)
+        assert.Equal(t, 2, key.Version)
+
+        active, err := store.GetActiveKeyForCustomer("acme")
+        require.NoError(t, err)
+        assert.Equal(t, "kid-2", active.KID)
+        assert.Equal(t, "v2", active.SecretKey)
+
+        // The previous key verifies during the overlap window
+        previous, err := store.GetVerificationKey("kid-1")
+        require.NoError(t, err)
+        assert.Equal(t, models.KeyStatusVerifying, previous.Status)
+        keys, err := store.ListVerificationKeys("")
+        require.NoError(t, err)
+        assert.Len(t, keys, 2)
+
+        // Without overlap it is retired at once
+        _, err = store.RotateCustomerKey("acme", "kid-3", "v3", "HS256", 0)
+        require.NoError(t, err)
+        _, err = store.GetVerificationKey("kid-2")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+        keys, err = store.ListCustomerKeys("acme")
+        require.NoError(t, err)
+        assert.Len(t, keys, 3)
+    })
+
+    t.Run("revoked tokens", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+
+        require.NoError(t, store.RevokeToken("live", "acme", "leaked", time.Now().Add(time.Hour)))
+        require.NoError(t, store.RevokeToken("expired", "acme", "leaked", time.Now().Add(-time.Hour)))
+        purged, err := store.PurgeExpiredRevokedTokens()
+        require.NoError(t, err)
+        assert.Equal(t, int64(1), purged)
+
+        revoked, err := store.ListRevokedTokens()
+        require.NoError(t, err)
+        assert.Contains(t, revoked, "live")
+        assert.NotContains(t, revoked, "expired")
+
+        validAfter, err := store.RevokeAllCustomerTokens("acme")
+        require.NoError(t, err)
+        customer, _ := store.GetCustomerByID("acme")
+        assert.True(t, validAfter.Equal(*customer.TokensValidAfter))
+    })
+
+    t.Run("refresh tokens", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+
+        expiresAt := time.Now().Add(time.Hour)
+        require.NoError(t, store.CreateRefreshToken("first", &models.RefreshToken{FamilyID: "family", CustomerID: "acme", UserID: "alice", Scopes: []string{"read"}, Audience: []string{"orders"}, ExpiresAt: expiresAt}))
+
+        token, err := store.RotateRefreshToken("first", "second", expiresAt)
+        require.NoError(t, err)
+        assert.Equal(t, "alice", token.UserID)
+        assert.Equal(t, []string{"read"}, token.Scopes)
+        assert.Equal(t, []string{"orders"}, token.Audience)
+
+        // Replaying a used token revokes its family
+        _, err = store.RotateRefreshToken("first", "third", expiresAt)
+        assert.Equal(t, ErrRefreshTokenReused, err)
+        _, err = store.GetRefreshToken("second")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+        require.NoError(t, store.CreateRefreshToken("expired", &models.RefreshToken{FamilyID: "other", CustomerID: "acme", ExpiresAt: time.Now().Add(-time.Hour)}))
+        purged, err := store.PurgeExpiredRefreshTokens()
+        require.NoError(t, err)
+        assert.Equal(t, int64(1), purged)
+    })
+
+    t.Run("users, routes and introspection clients", func(t *testing.T) {
+        store := newStore(t)
+        require.NoError(t, store.CreateCustomer(newCustomer("acme"), "kid-1"))
+
+        require.NoError(t, store.CreateUser(&models.User{CustomerID: "acme", UserID: "alice"}))
+        user, err := store.GetUser("acme", "alice")
+        require.NoError(t, err)
+        assert.Equal(t, "alice", user.UserID)
+        require.NoError(t, store.DeleteUser("acme", "alice"))
+        _, err = store.GetUser("acme", "alice")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+
+        route := &models.RouteScope{PathPrefix: "/orders", Method: "POST", Scope: "orders:write"}
+        require.NoError(t, store.CreateRouteScope(route))
+        routes, err := store.ListRouteScopes()
+        require.NoError(t, err)
+        require.Len(t, routes, 1)
+        assert.Equal(t, "orders:write", routes[0].Scope)
+        require.NoError(t, store.DeleteRouteScope(routes[0].ID))
+
+        require.NoError(t, store.CreateIntrospectionClient(&models.IntrospectionClient{ClientID: "gateway", ClientSecretHash: "hash", Name: "Gateway"}))
+        client, err := store.GetIntrospectionClient("gateway")
+        require.NoError(t, err)
+        assert.Equal(t, "Gateway", client.Name)
+        require.NoError(t, store.DeleteIntrospectionClient("gateway"))
+        _, err = store.GetIntrospectionClient("gateway")
+        assert.True(t, errors.Is(err, sql.ErrNoRows))
+    })
+
+    t.Run("rate limit buckets", func(t *testing.T) {
+        store := newStore(t)
+
+        take := func(bucket *models.RateLimitBucket, now time.Time) {
+            bucket.Tokens--
+            bucket.UpdatedAt = now
+        }
+        require.NoError(t, store.UpdateRateLimitBucket("acme", 5, take))
+        var tokens float64
+        require.NoError(t, store.UpdateRateLimitBucket("acme", 5, func(bucket *models.RateLimitBucket, now time.Time) {
+            tokens = bucket.Tokens
+            take(bucket, now)
+        }))
+        assert.Equal(t, float64(4), tokens)
+
+        purged, err := store.PurgeIdleRateLimitBuckets(time.Hour)
+        require.NoError(t, err)
+        assert.Zero(t, purged)
+    })
+}
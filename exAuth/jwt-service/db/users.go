@@ -0,0 +1,73 @@
+package db
+
+import (
+    "database/sql"
+
+    "github.com/vishalk17/jwt-service/models"
+)
+
+func (d *Database) CreateUser(user *models.User) error {
+    query := `
+        INSERT INTO customer_users (customer_id, user_id)
+        VALUES ($1, $2)
+        RETURNING id, created_at
+    `
+
+    return d.DB.QueryRow(query, user.CustomerID, user.UserID).Scan(&user.ID, &user.CreatedAt)
+}
+
+// GetUser returns sql.ErrNoRows if the user does not belong to the customer
+func (d *Database) GetUser(customerID, userID string) (*models.User, error) {
+    query := `SELECT id, customer_id, user_id, created_at FROM customer_users WHERE customer_id = $1 AND user_id = $2`
+
+    user := &models.User{}
+    err := d.DB.QueryRow(query, customerID, userID).Scan(
+        &user.ID,
+        &user.CustomerID,
+        &user.UserID,
+        &user.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    return user, nil
+}
+
+func (d *Database) ListUsers(customerID string) ([]*models.User, error) {
+    query := `SELECT id, customer_id, user_id, created_at FROM customer_users WHERE customer_id = $1 ORDER BY user_id`
+
+    rows, err := d.DB.Query(query, customerID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var users []*models.User
+    for rows.Next() {
+        user := &models.User{}
+        if err := rows.Scan(&user.ID, &user.CustomerID, &user.UserID, &user.CreatedAt); err != nil {
+            return nil, err
+        }
+        users = append(users, user)
+    }
+
+    return users, rows.Err()
+}
+
+func (d *Database) DeleteUser(customerID, userID string) error {
+    result, err := d.DB.Exec(`DELETE FROM customer_users WHERE customer_id = $1 AND user_id = $2`, customerID, userID)
+    if err != nil {
+        return err
+    }
+
+    deleted, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+    if deleted == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
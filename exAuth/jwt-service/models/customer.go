@@ -7,14 +7,116 @@ type Customer struct {
     CustomerID      string    `json:"customer_id"`
     AccountID       string    `json:"account_id"`
     SecretKey       string    `json:"-"` // Don't expose secret key in JSON
-    ExpirationMinutes int     `json:"expiration_minutes"`
+    SigningAlgorithm string   `json:"signing_algorithm"`
+    ClientID        string    `json:"client_id,omitempty"`
+    ClientSecretHash string   `json:"-"` // SHA-256 of the client secret, which is never stored
+    ExpirationMinutes int     `json:"expiration_minutes"` // Default token lifetime
+    MaxExpirationMinutes int  `json:"max_expiration_minutes,omitempty"` // Longest lifetime a token can be requested for, 0 for no customer limit
+    Scopes          []string  `json:"scopes,omitempty"` // Scopes the customer's tokens may be granted
+    RateLimitRequests int     `json:"rate_limit_requests,omitempty"` // Requests allowed per rate limit period, 0 for no limit
+    RateLimitPeriodSeconds int `json:"rate_limit_period_seconds,omitempty"`
+    RateLimitBurst  int       `json:"rate_limit_burst,omitempty"` // Requests that can be made at once, 0 for RateLimitRequests
+    Status          string    `json:"status"` // CustomerStatusActive, CustomerStatusSuspended or CustomerStatusDisabled
+    StatusReason    string    `json:"status_reason,omitempty"` // Why the customer was suspended or disabled
+    StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+    TokensValidAfter *time.Time `json:"tokens_valid_after,omitempty"` // Tokens issued before this are rejected
     CreatedAt       time.Time `json:"created_at"`
     UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// Customer states. Suspended and disabled customers can neither mint nor use
+// tokens. Suspension is meant to be temporary (e.g. an unpaid invoice);
+// disabling also revokes every token issued so far.
+const (
+    CustomerStatusActive    = "active"
+    CustomerStatusSuspended = "suspended"
+    CustomerStatusDisabled  = "disabled"
+)
+
+// Customer key states
+const (
+    KeyStatusActive    = "active"    // signs new tokens and verifies
+    KeyStatusVerifying = "verifying" // verifies existing tokens until VerifyUntil
+    KeyStatusRetired   = "retired"   // no longer accepted
+)
+
+type CustomerKey struct {
+    ID               int64      `json:"id"`
+    CustomerID       string     `json:"customer_id"`
+    KID              string     `json:"kid"`
+    Version          int        `json:"version"`
+    SecretKey        string     `json:"-"`
+    SigningAlgorithm string     `json:"signing_algorithm"`
+    Status           string     `json:"status"`
+    VerifyUntil      *time.Time `json:"verify_until,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+    RetiredAt        *time.Time `json:"retired_at,omitempty"`
+}
+
 type JWTPayload struct {
     CustomerID string `json:"customer_id"`
     AccountID  string `json:"account_id"`
     UserID     string `json:"user_id,omitempty"`
+    Scopes     []string `json:"scopes,omitempty"`
+    Audience   []string `json:"audience,omitempty"`
+    JTI        string `json:"jti,omitempty"`
+    Iat        int64  `json:"iat,omitempty"`
     Exp        int64  `json:"exp"`
-}
\ No newline at end of file
+}
+
+// HasScope reports whether the token was granted the scope
+func (p *JWTPayload) HasScope(scope string) bool {
+    for _, granted := range p.Scopes {
+        if granted == scope {
+            return true
+        }
+    }
+    return false
+}
+
+// RefreshToken is a stored refresh token. Every token minted from it keeps the
+// user, scope and audience of the token family.
+type RefreshToken struct {
+    FamilyID   string
+    CustomerID string
+    UserID     string
+    Scopes     []string
+    Audience   []string // empty for the service's audiences
+    ExpiresAt  time.Time
+}
+
+// RouteScope requires a scope for requests matching a host, path prefix and
+// method. An empty host or method matches any.
+type RouteScope struct {
+    ID         int64     `json:"id"`
+    Host       string    `json:"host,omitempty"`
+    PathPrefix string    `json:"path_prefix"`
+    Method     string    `json:"method,omitempty"`
+    Scope      string    `json:"scope"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// RateLimitBucket is the shared token bucket of a rate limited customer
+type RateLimitBucket struct {
+    Key       string
+    Tokens    float64
+    UpdatedAt time.Time
+}
+
+// IntrospectionClient is a service allowed to call the token introspection
+// endpoint
+type IntrospectionClient struct {
+    ID               int64     `json:"id"`
+    ClientID         string    `json:"client_id"`
+    ClientSecretHash string    `json:"-"`
+    Name             string    `json:"name"`
+    CreatedAt        time.Time `json:"created_at"`
+}
+
+// User is an end user of a customer that tokens can be issued for
+type User struct {
+    ID         int64     `json:"id"`
+    CustomerID string    `json:"customer_id"`
+    UserID     string    `json:"user_id"`
+    CreatedAt  time.Time `json:"created_at"`
+}
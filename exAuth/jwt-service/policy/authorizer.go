@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"strings"
+
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// Authorizer makes the authorization decision for a request after its token
+// has been verified
+type Authorizer interface {
+	// Public reports whether the request is allowed without a token
+	Public(req Request) bool
+	// Authorize decides a request made with a verified token
+	Authorize(input Input) Decision
+}
+
+// Input is what an authorization decision is made on
+type Input struct {
+	Request Request
+	Token   *models.JWTPayload
+	// Customer loads the token's customer record. It is only called by
+	// authorizers that need it.
+	Customer func() (*models.Customer, error)
+}
+
+// Chain combines authorizers: a request is public only if all of them make
+// it public, and is allowed only if all of them allow it. A route one
+// authorizer protects can therefore not be opened up by another.
+type Chain []Authorizer
+
+func (c Chain) Public(req Request) bool {
+	for _, authorizer := range c {
+		if !authorizer.Public(req) {
+			return false
+		}
+	}
+	return len(c) > 0
+}
+
+func (c Chain) Authorize(input Input) Decision {
+	var rules []string
+	for _, authorizer := range c {
+		decision := authorizer.Authorize(input)
+		if !decision.Allowed {
+			return decision
+		}
+		if decision.Rule != "" {
+			rules = append(rules, decision.Rule)
+		}
+	}
+	return Decision{Allowed: true, Rule: strings.Join(rules, ", ")}
+}
@@ -0,0 +1,234 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/google/cel-go/cel"
+	"github.com/vishalk17/jwt-service/models"
+	"gopkg.in/yaml.v3"
+)
+
+// CELPolicy authorizes requests with CEL expressions over the request, the
+// verified token and the customer record. A CEL policy file looks like:
+//
+//	public:
+//	- request.path == "/health"
+//	rules:
+//	- name: orders need an account
+//	  expression: '!request.path.startsWith("/orders") || token.accountId != ""'
+//	- name: exports
+//	  expression: '!request.path.startsWith("/exports") || "exports" in customer.scopes'
+//	  message: exports are not enabled for this customer
+//
+// Public expressions can only use request. Every rule must evaluate to true
+// for a request to be allowed. The variables are:
+//
+//	request:  host, path, method
+//	token:    customerId, accountId, userId, jti, scopes, aud, iat, exp
+//	customer: customerId, accountId, signingAlgorithm, scopes, expirationMinutes
+type CELPolicy struct {
+	public []cel.Program
+	rules  []celRule
+	// needsCustomer is set when a rule uses the customer record, which
+	// costs a database lookup
+	needsCustomer bool
+}
+
+type celRule struct {
+	name    string
+	message string
+	program cel.Program
+}
+
+type celPolicyFile struct {
+	Public []string `yaml:"public"`
+	Rules  []struct {
+		Name       string `yaml:"name"`
+		Expression string `yaml:"expression"`
+		Message    string `yaml:"message"`
+	} `yaml:"rules"`
+}
+
+// ParseCEL decodes a YAML or JSON CEL policy and compiles its expressions
+func ParseCEL(data []byte) (*CELPolicy, error) {
+	file := &celPolicyFile{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("failed to parse CEL policy: %w", err)
+	}
+
+	requestEnv, err := cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	env, err := requestEnv.Extend(
+		cel.Variable("token", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("customer", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &CELPolicy{}
+	for i, expression := range file.Public {
+		program, _, err := compileCEL(requestEnv, expression)
+		if err != nil {
+			return nil, fmt.Errorf("public expression %d: %w", i+1, err)
+		}
+		policy.public = append(policy.public, program)
+	}
+
+	for i, rule := range file.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		program, usesCustomer, err := compileCEL(env, rule.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		message := rule.Message
+		if message == "" {
+			message = fmt.Sprintf("denied by %s", name)
+		}
+		policy.rules = append(policy.rules, celRule{name: name, message: message, program: program})
+		policy.needsCustomer = policy.needsCustomer || usesCustomer
+	}
+
+	return policy, nil
+}
+
+// compileCEL compiles a boolean expression and reports whether it uses the
+// customer variable
+func compileCEL(env *cel.Env, expression string) (cel.Program, bool, error) {
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, false, issues.Err()
+	}
+	// Claims are dynamically typed, so dyn results are checked when evaluated
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, false, fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, false, err
+	}
+
+	usesCustomer := false
+	for _, ref := range ast.NativeRep().ReferenceMap() {
+		if ref.Name == "customer" {
+			usesCustomer = true
+		}
+	}
+	return program, usesCustomer, nil
+}
+
+// Public reports whether a public expression matches the request. Evaluation
+// errors count as not public.
+func (p *CELPolicy) Public(req Request) bool {
+	activation := map[string]any{"request": requestVariable(req)}
+	for _, program := range p.public {
+		allowed, err := evalCEL(program, activation)
+		if err != nil {
+			log.Printf("Failed to evaluate public CEL expression: %v", err)
+			continue
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize requires every rule to evaluate to true. Evaluation errors deny
+// the request.
+func (p *CELPolicy) Authorize(input Input) Decision {
+	activation := map[string]any{
+		"request":  requestVariable(input.Request),
+		"token":    tokenVariable(input.Token),
+		"customer": map[string]any{},
+	}
+
+	if p.needsCustomer {
+		if input.Customer == nil {
+			return Decision{Reason: "customer record is not available"}
+		}
+		customer, err := input.Customer()
+		if err != nil {
+			log.Printf("Failed to load customer %s for CEL policy: %v", input.Token.CustomerID, err)
+			return Decision{Reason: "customer record is not available"}
+		}
+		activation["customer"] = customerVariable(customer)
+	}
+
+	for _, rule := range p.rules {
+		allowed, err := evalCEL(rule.program, activation)
+		if err != nil {
+			log.Printf("Failed to evaluate CEL rule %q: %v", rule.name, err)
+			return Decision{Rule: rule.name, Reason: fmt.Sprintf("%s could not be evaluated", rule.name)}
+		}
+		if !allowed {
+			return Decision{Rule: rule.name, Reason: rule.message}
+		}
+	}
+
+	return Decision{Allowed: true}
+}
+
+func evalCEL(program cel.Program, activation map[string]any) (bool, error) {
+	result, _, err := program.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+	allowed, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %v instead of a bool", result.Value())
+	}
+	return allowed, nil
+}
+
+func requestVariable(req Request) map[string]any {
+	return map[string]any{
+		"host":   req.Host,
+		"path":   req.Path,
+		"method": req.Method,
+	}
+}
+
+func tokenVariable(payload *models.JWTPayload) map[string]any {
+	return map[string]any{
+		"customerId": payload.CustomerID,
+		"accountId":  payload.AccountID,
+		"userId":     payload.UserID,
+		"jti":        payload.JTI,
+		"scopes":     stringList(payload.Scopes),
+		"aud":        stringList(payload.Audience),
+		"iat":        payload.Iat,
+		"exp":        payload.Exp,
+	}
+}
+
+func customerVariable(customer *models.Customer) map[string]any {
+	return map[string]any{
+		"customerId":        customer.CustomerID,
+		"accountId":         customer.AccountID,
+		"signingAlgorithm":  customer.SigningAlgorithm,
+		"scopes":            stringList(customer.Scopes),
+		"expirationMinutes": customer.ExpirationMinutes,
+	}
+}
+
+// stringList avoids passing a nil slice, which CEL treats as null
+func stringList(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+const testCELPolicy = `
+public:
+- request.path == "/health"
+rules:
+- name: orders need an account
+  expression: '!request.path.startsWith("/orders") || token.accountId != ""'
+- name: exports
+  expression: '!request.path.startsWith("/exports") || "exports" in customer.scopes'
+  message: exports are not enabled for this customer
+`
+
+func TestParseCELInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":         "rule:\n- expression: 'true'\n",
+		"syntax error":        "rules:\n- expression: 'request.path =='\n",
+		"not a bool":          "rules:\n- expression: '\"allow\"'\n",
+		"token in public":     "public:\n- token.customerId == \"acme\"\n",
+		"undeclared variable": "rules:\n- expression: 'user.admin'\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCEL([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCELAuthorize(t *testing.T) {
+	policy, err := ParseCEL([]byte(testCELPolicy))
+	assert.NoError(t, err)
+	assert.True(t, policy.needsCustomer)
+
+	assert.True(t, policy.Public(Request{"api.example.com", "/health", "GET"}))
+	assert.False(t, policy.Public(Request{"api.example.com", "/orders", "GET"}))
+
+	acme := &models.JWTPayload{CustomerID: "acme", AccountID: "acme-account"}
+	withScopes := func(scopes ...string) func() (*models.Customer, error) {
+		return func() (*models.Customer, error) {
+			return &models.Customer{CustomerID: "acme", Scopes: scopes}, nil
+		}
+	}
+
+	tests := map[string]struct {
+		input   Input
+		allowed bool
+		reason  string
+	}{
+		"allowed":          {Input{Request{"", "/orders/42", "GET"}, acme, withScopes()}, true, ""},
+		"missing account":  {Input{Request{"", "/orders", "GET"}, &models.JWTPayload{CustomerID: "acme"}, withScopes()}, false, "denied by orders need an account"},
+		"customer scope":   {Input{Request{"", "/exports", "GET"}, acme, withScopes("exports")}, true, ""},
+		"custom message":   {Input{Request{"", "/exports", "GET"}, acme, withScopes("orders")}, false, "exports are not enabled for this customer"},
+		"no customer":      {Input{Request{"", "/orders", "GET"}, acme, nil}, false, "customer record is not available"},
+		"customer failure": {Input{Request{"", "/orders", "GET"}, acme, func() (*models.Customer, error) { return nil, errors.New("database down") }}, false, "customer record is not available"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			decision := policy.Authorize(tc.input)
+			assert.Equal(t, tc.allowed, decision.Allowed)
+			assert.Equal(t, tc.reason, decision.Reason)
+		})
+	}
+}
+
+func TestCELCustomerLoadedOnlyWhenUsed(t *testing.T) {
+	policy, err := ParseCEL([]byte("rules:\n- expression: '\"read\" in token.scopes'\n"))
+	assert.NoError(t, err)
+
+	loaded := false
+	decision := policy.Authorize(Input{
+		Request: Request{"", "/orders", "GET"},
+		Token:   &models.JWTPayload{CustomerID: "acme", Scopes: []string{"read"}},
+		Customer: func() (*models.Customer, error) {
+			loaded = true
+			return &models.Customer{}, nil
+		},
+	})
+	assert.True(t, decision.Allowed)
+	assert.False(t, loaded)
+}
+
+func TestChain(t *testing.T) {
+	rules, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+	celPolicy, err := ParseCEL([]byte("public:\n- request.path == '/status'\nrules:\n- name: readers\n  expression: '\"read\" in token.scopes'\n"))
+	assert.NoError(t, err)
+	chain := Chain{rules, celPolicy}
+
+	// Public only where every policy agrees
+	assert.False(t, chain.Public(Request{"api.example.com", "/health", "GET"}))
+	assert.False(t, chain.Public(Request{"api.example.com", "/status", "GET"}))
+	assert.True(t, Chain{rules, rules}.Public(Request{"api.example.com", "/health", "GET"}))
+	assert.False(t, Chain{}.Public(Request{"api.example.com", "/health", "GET"}))
+
+	req := Request{"api.example.com", "/orders", "GET"}
+	decision := chain.Authorize(Input{Request: req, Token: &models.JWTPayload{CustomerID: "acme", AccountID: "acme-account", Scopes: []string{"read"}}})
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "orders", decision.Rule)
+
+	decision = chain.Authorize(Input{Request: req, Token: &models.JWTPayload{CustomerID: "acme", AccountID: "acme-account"}})
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "readers", decision.Rule)
+}
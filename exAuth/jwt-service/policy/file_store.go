@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileStore serves the authorizer loaded from a policy file and reloads it
+// whenever the file changes. An invalid update is logged and the previous
+// policy is kept.
+type FileStore struct {
+	filename   string
+	parse      func([]byte) (Authorizer, error)
+	authorizer atomic.Value // Authorizer
+	watcher    *fsnotify.Watcher
+}
+
+// NewFileStore loads a rule policy file (see Policy) and starts watching it
+// for changes
+func NewFileStore(filename string) (*FileStore, error) {
+	return newFileStore(filename, func(data []byte) (Authorizer, error) {
+		return Parse(data)
+	})
+}
+
+// NewCELFileStore loads a CEL policy file (see CELPolicy) and starts watching
+// it for changes
+func NewCELFileStore(filename string) (*FileStore, error) {
+	return newFileStore(filename, func(data []byte) (Authorizer, error) {
+		return ParseCEL(data)
+	})
+}
+
+func newFileStore(filename string, parse func([]byte) (Authorizer, error)) (*FileStore, error) {
+	store := &FileStore{filename: filename, parse: parse}
+
+	authorizer, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+	store.authorizer.Store(authorizer)
+
+	// Watch the directory rather than the file: editors and Kubernetes
+	// ConfigMap updates replace the file instead of writing to it
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch policy file: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(filename)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch policy file: %w", err)
+	}
+	store.watcher = watcher
+	go store.watch()
+
+	return store, nil
+}
+
+// Authorizer returns the current policy
+func (s *FileStore) Authorizer() Authorizer {
+	return s.authorizer.Load().(Authorizer)
+}
+
+func (s *FileStore) Public(req Request) bool {
+	return s.Authorizer().Public(req)
+}
+
+func (s *FileStore) Authorize(input Input) Decision {
+	return s.Authorizer().Authorize(input)
+}
+
+// Close stops watching the policy file
+func (s *FileStore) Close() error {
+	return s.watcher.Close()
+}
+
+func (s *FileStore) load() (Authorizer, error) {
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return s.parse(data)
+}
+
+func (s *FileStore) watch() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if !s.affects(event) {
+				continue
+			}
+			s.reload()
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Policy file watcher error: %v", err)
+		}
+	}
+}
+
+// affects reports whether an event in the watched directory may have changed
+// the policy file. ConfigMap volumes swap a "..data" symlink.
+func (s *FileStore) affects(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Base(event.Name)
+	return name == filepath.Base(s.filename) || name == "..data"
+}
+
+func (s *FileStore) reload() {
+	authorizer, err := s.load()
+	if err != nil {
+		log.Printf("Failed to reload policy file %s, keeping previous policy: %v", s.filename, err)
+		return
+	}
+
+	s.authorizer.Store(authorizer)
+	log.Printf("Reloaded policy file %s", s.filename)
+}
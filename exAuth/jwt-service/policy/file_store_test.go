@@ -0,0 +1,42 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("default: allow\n"), 0o644))
+
+	store, err := NewFileStore(filename)
+	require.NoError(t, err)
+	defer store.Close()
+	assert.Equal(t, DefaultAllow, store.Authorizer().(*Policy).Default)
+
+	require.NoError(t, os.WriteFile(filename, []byte("default: deny\n"), 0o644))
+	assert.Eventually(t, func() bool {
+		return store.Authorizer().(*Policy).Default == DefaultDeny
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// An invalid update keeps the previous policy
+	require.NoError(t, os.WriteFile(filename, []byte("default: maybe\n"), 0o644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, DefaultDeny, store.Authorizer().(*Policy).Default)
+}
+
+func TestNewFileStoreInvalid(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("rules: {}\n"), 0o644))
+
+	_, err := NewFileStore(filename)
+	assert.Error(t, err)
+
+	_, err = NewFileStore(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
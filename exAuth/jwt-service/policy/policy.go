@@ -0,0 +1,264 @@
+package policy
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/vishalk17/jwt-service/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Default actions for requests that match no rule
+const (
+	DefaultAllow = "allow" // any valid token is accepted
+	DefaultDeny  = "deny"
+)
+
+// Request describes the original request being authorized
+type Request struct {
+	Host   string
+	Path   string
+	Method string
+}
+
+// Policy is an ordered list of rules; the first rule matching a request
+// decides it. A policy file looks like:
+//
+//	default: allow
+//	rules:
+//	- name: health
+//	  paths: ["/health"]
+//	  public: true
+//	- name: orders
+//	  hosts: ["api.example.com"]
+//	  paths: ["/orders", "/orders/*"]
+//	  methods: ["GET", "POST"]
+//	  require_claims: ["accountId"]
+//	  allow_customers: ["acme", "globex"]
+//	  audiences: ["orders-api"]
+//
+// JSON files use the same keys.
+type Policy struct {
+	Default string `yaml:"default"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Rule matches requests by host, path and method. Empty lists match anything.
+type Rule struct {
+	Name string `yaml:"name"`
+	// Hosts are exact host names or "*.example.com" wildcards
+	Hosts []string `yaml:"hosts"`
+	// Paths are exact paths, globs ("/orders/*/items") or prefixes ending
+	// in "*" ("/orders/*" matches everything below /orders/)
+	Paths   []string `yaml:"paths"`
+	Methods []string `yaml:"methods"`
+	// Public requests are allowed without a token
+	Public bool `yaml:"public"`
+	// RequireClaims lists claims that must be present and non-empty
+	RequireClaims []string `yaml:"require_claims"`
+	// AllowCustomers restricts the rule to these customer IDs
+	AllowCustomers []string `yaml:"allow_customers"`
+	// Audiences requires the token to be issued for one of them
+	Audiences []string `yaml:"audiences"`
+}
+
+// Decision is the outcome of authorizing a request
+type Decision struct {
+	Allowed bool
+	Rule    string // name of the matching rule, empty for the default action
+	Reason  string // why the request was denied
+}
+
+// claims that rules can require, by claim name
+var claimValues = map[string]func(*models.JWTPayload) string{
+	"customerId": func(p *models.JWTPayload) string { return p.CustomerID },
+	"accountId":  func(p *models.JWTPayload) string { return p.AccountID },
+	"userId":     func(p *models.JWTPayload) string { return p.UserID },
+	"jti":        func(p *models.JWTPayload) string { return p.JTI },
+	"scope":      func(p *models.JWTPayload) string { return strings.Join(p.Scopes, " ") },
+}
+
+// LoadFile reads and validates a YAML or JSON policy file
+func LoadFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a YAML or JSON policy. Unknown keys are
+// rejected so that a typo cannot silently weaken a rule.
+func Parse(data []byte) (*Policy, error) {
+	policy := &Policy{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	switch p.Default {
+	case "":
+		p.Default = DefaultAllow
+	case DefaultAllow, DefaultDeny:
+	default:
+		return fmt.Errorf("invalid default action %q, must be %q or %q", p.Default, DefaultAllow, DefaultDeny)
+	}
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Public && (len(rule.RequireClaims) > 0 || len(rule.AllowCustomers) > 0 || len(rule.Audiences) > 0) {
+			return fmt.Errorf("%s: public rules cannot require claims, customers or audiences", rule.Name)
+		}
+		for _, claim := range rule.RequireClaims {
+			if _, ok := claimValues[claim]; !ok {
+				return fmt.Errorf("%s: unknown claim %q", rule.Name, claim)
+			}
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, "/"); err != nil {
+				return fmt.Errorf("%s: invalid path pattern %q: %w", rule.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Match returns the first rule matching the request, or nil
+func (p *Policy) Match(req Request) *Rule {
+	for i := range p.Rules {
+		if p.Rules[i].matches(req) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Public reports whether the request is allowed without a token
+func (p *Policy) Public(req Request) bool {
+	rule := p.Match(req)
+	return rule != nil && rule.Public
+}
+
+// Authorize decides a request made with a verified token
+func (p *Policy) Authorize(input Input) Decision {
+	payload := input.Token
+	rule := p.Match(input.Request)
+	if rule == nil {
+		if p.Default == DefaultDeny {
+			return Decision{Reason: "no policy rule allows this request"}
+		}
+		return Decision{Allowed: true}
+	}
+
+	if rule.Public {
+		return Decision{Allowed: true, Rule: rule.Name}
+	}
+
+	for _, claim := range rule.RequireClaims {
+		if claimValues[claim](payload) == "" {
+			return Decision{Rule: rule.Name, Reason: fmt.Sprintf("%s requires claim %s", rule.Name, claim)}
+		}
+	}
+
+	if len(rule.AllowCustomers) > 0 && !contains(rule.AllowCustomers, payload.CustomerID) {
+		return Decision{Rule: rule.Name, Reason: fmt.Sprintf("customer %s is not allowed by %s", payload.CustomerID, rule.Name)}
+	}
+
+	if len(rule.Audiences) > 0 && !containsAny(rule.Audiences, payload.Audience) {
+		return Decision{Rule: rule.Name, Reason: fmt.Sprintf("token is not issued for an audience of %s", rule.Name)}
+	}
+
+	return Decision{Allowed: true, Rule: rule.Name}
+}
+
+func (r *Rule) matches(req Request) bool {
+	if len(r.Methods) > 0 && !containsFold(r.Methods, req.Method) {
+		return false
+	}
+	if len(r.Hosts) > 0 && !matchHost(r.Hosts, req.Host) {
+		return false
+	}
+	if len(r.Paths) > 0 && !matchPath(r.Paths, req.Path) {
+		return false
+	}
+	return true
+}
+
+func matchHost(patterns []string, host string) bool {
+	// The authority may include a port
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(patterns []string, requestPath string) bool {
+	requestPath, _, _ = strings.Cut(requestPath, "?")
+
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, "*?[") {
+			if strings.HasPrefix(requestPath, prefix) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
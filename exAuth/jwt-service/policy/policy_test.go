@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+const testPolicy = `
+default: deny
+rules:
+- name: health
+  paths: ["/health"]
+  public: true
+- name: orders
+  hosts: ["api.example.com", "*.internal.example.com"]
+  paths: ["/orders", "/orders/*"]
+  methods: ["GET", "POST"]
+  require_claims: ["accountId"]
+  allow_customers: ["acme"]
+- name: reports
+  paths: ["/reports/*/download"]
+- name: payments
+  paths: ["/payments/*"]
+  audiences: ["payments-api"]
+`
+
+func TestParse(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDeny, policy.Default)
+	assert.Len(t, policy.Rules, 4)
+
+	// JSON uses the same keys
+	policy, err = Parse([]byte(`{"rules": [{"paths": ["/health"], "public": true}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAllow, policy.Default)
+	assert.Equal(t, "rule 1", policy.Rules[0].Name)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":          "rules:\n- name: orders\n  require_claim: [accountId]\n",
+		"invalid default":      "default: maybe\n",
+		"unknown claim":        "rules:\n- require_claims: [email]\n",
+		"public with claims":   "rules:\n- public: true\n  require_claims: [accountId]\n",
+		"public with audience": "rules:\n- public: true\n  audiences: [payments-api]\n",
+		"invalid path pattern": "rules:\n- paths: [\"/orders/[\"]\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+
+	acme := &models.JWTPayload{CustomerID: "acme", AccountID: "acme-account"}
+
+	tests := map[string]struct {
+		req     Request
+		payload *models.JWTPayload
+		allowed bool
+		rule    string
+	}{
+		"public":              {Request{"api.example.com", "/health", "GET"}, acme, true, "health"},
+		"allowed":             {Request{"api.example.com", "/orders/42?expand=items", "GET"}, acme, true, "orders"},
+		"wildcard host":       {Request{"eu.internal.example.com:8443", "/orders", "POST"}, acme, true, "orders"},
+		"missing claim":       {Request{"api.example.com", "/orders", "GET"}, &models.JWTPayload{CustomerID: "acme"}, false, "orders"},
+		"customer not listed": {Request{"api.example.com", "/orders", "GET"}, &models.JWTPayload{CustomerID: "globex", AccountID: "globex-account"}, false, "orders"},
+		"glob":                {Request{"api.example.com", "/reports/2024/download", "GET"}, acme, true, "reports"},
+		"default deny":        {Request{"api.example.com", "/orders", "DELETE"}, acme, false, ""},
+		"audience":            {Request{"api.example.com", "/payments/42", "GET"}, &models.JWTPayload{CustomerID: "acme", Audience: []string{"orders-api", "payments-api"}}, true, "payments"},
+		"other audience":      {Request{"api.example.com", "/payments/42", "GET"}, &models.JWTPayload{CustomerID: "acme", Audience: []string{"orders-api"}}, false, "payments"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			decision := policy.Authorize(Input{Request: tc.req, Token: tc.payload})
+			assert.Equal(t, tc.allowed, decision.Allowed)
+			assert.Equal(t, tc.rule, decision.Rule)
+			if !tc.allowed {
+				assert.NotEmpty(t, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestPublic(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	assert.NoError(t, err)
+
+	assert.True(t, policy.Public(Request{Host: "api.example.com", Path: "/health", Method: "GET"}))
+	assert.False(t, policy.Public(Request{Host: "api.example.com", Path: "/orders", Method: "GET"}))
+}
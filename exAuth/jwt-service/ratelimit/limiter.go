@@ -0,0 +1,147 @@
+// Package ratelimit enforces per-customer request quotas with token buckets,
+// either in memory for a single replica or in Postgres for several.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/vishalk17/jwt-service/db"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+// Limit is a token bucket that refills Requests tokens every Period and holds
+// up to Burst tokens. A request usually takes one token.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int // 0 uses Requests
+}
+
+// CustomerLimit returns the customer's configured limit
+func CustomerLimit(customer *models.Customer) Limit {
+	period := time.Duration(customer.RateLimitPeriodSeconds) * time.Second
+	if period <= 0 {
+		period = time.Second
+	}
+	return Limit{
+		Requests: customer.RateLimitRequests,
+		Period:   period,
+		Burst:    customer.RateLimitBurst,
+	}
+}
+
+// Unlimited reports whether the limit does not restrict requests
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// Capacity is the number of tokens a full bucket holds
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// rate is the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token, with what is needed for the
+// Retry-After and X-RateLimit-* response headers
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket capacity
+	Remaining  int           // whole tokens left
+	RetryAfter time.Duration // until a token is available, 0 when allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Limiter takes n tokens from the bucket with the given key
+type Limiter interface {
+	AllowN(key string, limit Limit, n int) (Result, error)
+}
+
+// take refills the bucket for the time since its last update and takes n
+// tokens if they are available. Requests for more tokens than the bucket
+// holds are always rejected.
+func take(bucket *models.RateLimitBucket, limit Limit, n int, now time.Time) Result {
+	capacity := float64(limit.Capacity())
+	rate := limit.rate()
+
+	// Clocks can step backwards; never drain a bucket because of it
+	elapsed := now.Sub(bucket.UpdatedAt).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens := math.Min(capacity, bucket.Tokens+elapsed*rate)
+
+	result := Result{Limit: limit.Capacity()}
+	if tokens >= float64(n) {
+		tokens -= float64(n)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((math.Min(float64(n), capacity) - tokens) / rate)
+	}
+
+	bucket.Tokens = tokens
+	bucket.UpdatedAt = now
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = secondsToDuration((capacity - tokens) / rate)
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// MemoryLimiter keeps buckets in process memory. Each replica enforces the
+// full limit on its own, so it is only accurate with a single replica.
+// Buckets are keyed by customer and never evicted.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*models.RateLimitBucket
+	now     func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*models.RateLimitBucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) AllowN(key string, limit Limit, n int) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &models.RateLimitBucket{Key: key, Tokens: float64(limit.Capacity()), UpdatedAt: now}
+		m.buckets[key] = bucket
+	}
+	return take(bucket, limit, n, now), nil
+}
+
+// PostgresLimiter keeps buckets in the rate_limit_buckets table so that all
+// replicas share one quota per customer, at the cost of a transaction per
+// request. Any CustomerStore works; only Postgres is shared between replicas.
+type PostgresLimiter struct {
+	db db.CustomerStore
+}
+
+func NewPostgresLimiter(store db.CustomerStore) *PostgresLimiter {
+	return &PostgresLimiter{db: store}
+}
+
+func (p *PostgresLimiter) AllowN(key string, limit Limit, n int) (Result, error) {
+	var result Result
+	err := p.db.UpdateRateLimitBucket(key, float64(limit.Capacity()), func(bucket *models.RateLimitBucket, now time.Time) {
+		result = take(bucket, limit, n, now)
+	})
+	return result, err
+}
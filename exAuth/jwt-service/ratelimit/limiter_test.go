@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishalk17/jwt-service/models"
+)
+
+func TestCustomerLimit(t *testing.T) {
+	limit := CustomerLimit(&models.Customer{RateLimitRequests: 100, RateLimitPeriodSeconds: 60})
+	assert.Equal(t, Limit{Requests: 100, Period: time.Minute}, limit)
+	assert.False(t, limit.Unlimited())
+	assert.Equal(t, 100, limit.Capacity())
+
+	limit = CustomerLimit(&models.Customer{RateLimitRequests: 10, RateLimitBurst: 25})
+	assert.Equal(t, time.Second, limit.Period)
+	assert.Equal(t, 25, limit.Capacity())
+
+	assert.True(t, CustomerLimit(&models.Customer{}).Unlimited())
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+
+	// 2 requests per second with a burst of 3
+	limit := Limit{Requests: 2, Period: time.Second, Burst: 3}
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := limiter.AllowN("acme", limit, 1)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+
+	result, _ := limiter.AllowN("acme", limit, 1)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// Other customers have their own bucket
+	result, _ = limiter.AllowN("globex", limit, 1)
+	assert.True(t, result.Allowed)
+
+	// Half a second refills one token
+	now = now.Add(500 * time.Millisecond)
+	result, _ = limiter.AllowN("acme", limit, 1)
+	assert.True(t, result.Allowed)
+	result, _ = limiter.AllowN("acme", limit, 1)
+	assert.False(t, result.Allowed)
+
+	// The bucket never holds more than the burst
+	now = now.Add(time.Hour)
+	result, _ = limiter.AllowN("acme", limit, 1)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestTakeClockSkew(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bucket := &models.RateLimitBucket{Tokens: 0.5, UpdatedAt: now}
+
+	// A clock that stepped backwards neither refills nor drains the bucket
+	result := take(bucket, Limit{Requests: 1, Period: time.Minute}, 1, now.Add(-time.Minute))
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0.5, bucket.Tokens)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+}
+
+func TestTakeN(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limit := Limit{Requests: 10, Period: time.Second}
+	bucket := &models.RateLimitBucket{Tokens: 10, UpdatedAt: now}
+
+	result := take(bucket, limit, 4, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 6, result.Remaining)
+
+	result = take(bucket, limit, 8, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 200*time.Millisecond, result.RetryAfter)
+
+	// More than the bucket can ever hold
+	result = take(bucket, limit, 11, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 6, result.Remaining)
+}